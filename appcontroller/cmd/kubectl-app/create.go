@@ -0,0 +1,77 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
+)
+
+func runCreate(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("create", pflag.ContinueOnError)
+	image := fs.String("image", "", "The container image to run.")
+	host := fs.String("host", "", "The hostname to expose the App on. No Ingress is created when empty.")
+	replicas := fs.Int32("replicas", 1, "The number of replicas to run.")
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+	if *image == "" {
+		return fmt.Errorf("--image must be specified")
+	}
+
+	app, err := c.appClient.AppcontrollerV1().Apps(c.namespace).Create(ctx, newApp(c.namespace, names[0], *image, *host, *replicas), metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "app.%s/%s created\n", appv1.SchemeGroupVersion.Group, app.Name)
+	return nil
+}
+
+// newApp builds an App whose children are named after the App, following the
+// layout of artifacts/crd/example.yaml.
+func newApp(namespace, name, image, host string, replicas int32) *appv1.App {
+	app := &appv1.App{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: appv1.AppSpec{
+			Deployment: appv1.DeploymentSpec{
+				Name:     name + "-deployment",
+				Image:    image,
+				Replicas: &replicas,
+			},
+			Service: appv1.ServiceSpec{
+				Name: name + "-service",
+			},
+		},
+	}
+	if host != "" {
+		app.Spec.Ingress = appv1.IngressSpec{
+			Name:     name + "-ingress",
+			Hostname: host,
+		}
+	}
+	return app
+}
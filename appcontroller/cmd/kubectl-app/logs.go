@@ -0,0 +1,119 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func runLogs(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("logs", pflag.ContinueOnError)
+	follow := fs.BoolP("follow", "f", false, "Stream the logs.")
+	tail := fs.Int64("tail", -1, "Lines of recent log to display per pod. -1 shows all lines.")
+	since := fs.Duration("since", 0, "Only return logs newer than a relative duration like 5s, 2m, or 3h.")
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+
+	opts := &corev1.PodLogOptions{Follow: *follow}
+	if *tail >= 0 {
+		opts.TailLines = tail
+	}
+	if *since > 0 {
+		seconds := int64(since.Round(time.Second).Seconds())
+		opts.SinceSeconds = &seconds
+	}
+	return c.logs(ctx, names[0], opts)
+}
+
+// logs streams the logs of every container of every pod selected by the App's
+// Deployment, prefixing each line with its origin.
+func (c *cli) logs(ctx context.Context, name string, opts *corev1.PodLogOptions) error {
+	app, err := c.appClient.AppcontrollerV1().Apps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	deployment, err := c.kubeClient.AppsV1().Deployments(c.namespace).Get(ctx, app.Spec.Deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods, err := c.kubeClient.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no pods found for app %q", name)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			podOpts := opts.DeepCopy()
+			podOpts.Container = container.Name
+			prefix := fmt.Sprintf("[%s/%s] ", pod.Name, container.Name)
+
+			wg.Add(1)
+			go func(podName string) {
+				defer wg.Done()
+				if err := c.streamLogs(ctx, podName, podOpts, prefix, &mu); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s: %w", podName, err))
+					mu.Unlock()
+				}
+			}(pod.Name)
+		}
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// streamLogs copies one container's log to c.out line by line. mu serialises
+// writes so lines from different pods are never interleaved.
+func (c *cli) streamLogs(ctx context.Context, podName string, opts *corev1.PodLogOptions, prefix string, mu *sync.Mutex) error {
+	stream, err := c.kubeClient.CoreV1().Pods(c.namespace).GetLogs(podName, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		mu.Lock()
+		fmt.Fprintf(c.out, "%s%s\n", prefix, scanner.Text())
+		mu.Unlock()
+	}
+	return scanner.Err()
+}
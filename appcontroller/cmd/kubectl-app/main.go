@@ -0,0 +1,177 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-app is a kubectl plugin for App resources. Once the binary is on the
+// PATH it is invoked as "kubectl app <command>".
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	clientset "github.com/2456868764/operator/appcontroller/pkg/generated/clientset/versioned"
+)
+
+const usage = `kubectl app manages App resources.
+
+Usage:
+  kubectl app <command> [flags]
+
+Commands:
+  create NAME --image=IMAGE [--host=HOST] [--replicas=N]
+  status NAME
+  scale NAME --replicas=N
+  set image NAME IMAGE
+  pause NAME
+  resume NAME
+  rollback NAME [--to-revision=N]
+  logs NAME [-f] [--tail=N] [--since=DURATION]
+
+Global flags:
+  -n, --namespace    namespace of the App
+      --kubeconfig   path to the kubeconfig file
+      --context      kubeconfig context to use
+`
+
+// errUsage is returned when the command line is malformed. The usage text is
+// printed instead of the error itself.
+var errUsage = errors.New("invalid usage")
+
+// cli holds the clients and settings shared by every command.
+type cli struct {
+	kubeClient kubernetes.Interface
+	appClient  clientset.Interface
+	namespace  string
+	out        io.Writer
+}
+
+// configFlags are the connection flags accepted by every command.
+type configFlags struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func (f *configFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&f.context, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVarP(&f.namespace, "namespace", "n", "", "The namespace of the App. Defaults to the namespace of the current context.")
+}
+
+// newCLI builds the clients from the kubeconfig, honouring the same loading
+// rules as kubectl.
+func (f *configFlags) newCLI(out io.Writer) (*cli, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = f.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: f.context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %w", err)
+	}
+	namespace := f.namespace
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, err
+		}
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubernetes clientset: %w", err)
+	}
+	appClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building app clientset: %w", err)
+	}
+	return &cli{kubeClient: kubeClient, appClient: appClient, namespace: namespace, out: out}, nil
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		} else {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run dispatches args to the matching command.
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	name, args := args[0], args[1:]
+	if name == "set" {
+		if len(args) == 0 || args[0] != "image" {
+			return errUsage
+		}
+		name, args = "set image", args[1:]
+	}
+
+	switch name {
+	case "create":
+		return runCreate(ctx, args, out)
+	case "status":
+		return runStatus(ctx, args, out)
+	case "scale":
+		return runScale(ctx, args, out)
+	case "set image":
+		return runSetImage(ctx, args, out)
+	case "pause":
+		return runSetPaused(ctx, args, out, true)
+	case "resume":
+		return runSetPaused(ctx, args, out, false)
+	case "rollback":
+		return runRollback(ctx, args, out)
+	case "logs":
+		return runLogs(ctx, args, out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+// parse parses args with fs, which must already contain the command specific
+// flags, and returns a cli together with the exactly want positional
+// arguments.
+func parse(fs *pflag.FlagSet, args []string, want int, out io.Writer) (*cli, []string, error) {
+	var flags configFlags
+	flags.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() != want {
+		return nil, nil, errUsage
+	}
+	c, err := flags.newCLI(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
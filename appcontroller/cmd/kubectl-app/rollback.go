@@ -0,0 +1,128 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// revisionAnnotation is set by the Deployment controller on Deployments and
+// their ReplicaSets.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+func runRollback(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("rollback", pflag.ContinueOnError)
+	toRevision := fs.Int64("to-revision", 0, "The revision to roll back to. Defaults to the previous revision.")
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+	return c.rollback(ctx, names[0], *toRevision)
+}
+
+// rollback restores the image of an earlier Deployment revision on the App.
+// The App remains the source of truth, so rolling back the Deployment directly
+// would be reverted by the controller.
+func (c *cli) rollback(ctx context.Context, name string, toRevision int64) error {
+	app, err := c.appClient.AppcontrollerV1().Apps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	deployment, err := c.kubeClient.AppsV1().Deployments(c.namespace).Get(ctx, app.Spec.Deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	rsList, err := c.kubeClient.AppsV1().ReplicaSets(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+
+	var owned []*appsv1.ReplicaSet
+	for i := range rsList.Items {
+		if metav1.IsControlledBy(&rsList.Items[i], deployment) {
+			owned = append(owned, &rsList.Items[i])
+		}
+	}
+	current, _ := revision(deployment)
+	rs, err := findRevision(owned, current, toRevision)
+	if err != nil {
+		return err
+	}
+
+	image := containerImage(rs, app.Spec.Deployment.Name)
+	if image == "" {
+		return fmt.Errorf("revision %s of deployment %q has no container %q", rs.Annotations[revisionAnnotation], deployment.Name, app.Spec.Deployment.Name)
+	}
+	if image == app.Spec.Deployment.Image {
+		fmt.Fprintf(c.out, "skipped rollback (current template already matches revision %s)\n", rs.Annotations[revisionAnnotation])
+		return nil
+	}
+	return c.patchDeploymentSpec(ctx, name, "rolled back", map[string]interface{}{"image": image})
+}
+
+// findRevision returns the ReplicaSet with revision toRevision, or the newest
+// revision older than current when toRevision is zero.
+func findRevision(replicaSets []*appsv1.ReplicaSet, current, toRevision int64) (*appsv1.ReplicaSet, error) {
+	var found *appsv1.ReplicaSet
+	var foundRevision int64
+	for _, rs := range replicaSets {
+		v, err := revision(rs)
+		if err != nil {
+			continue
+		}
+		if toRevision != 0 {
+			if v == toRevision {
+				return rs, nil
+			}
+			continue
+		}
+		if v < current && v > foundRevision {
+			found, foundRevision = rs, v
+		}
+	}
+	if toRevision != 0 {
+		return nil, fmt.Errorf("unable to find revision %d", toRevision)
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no rollout history found")
+	}
+	return found, nil
+}
+
+func revision(obj metav1.Object) (int64, error) {
+	return strconv.ParseInt(obj.GetAnnotations()[revisionAnnotation], 10, 64)
+}
+
+func containerImage(rs *appsv1.ReplicaSet, name string) string {
+	for _, container := range rs.Spec.Template.Spec.Containers {
+		if container.Name == name {
+			return container.Image
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/2456868764/operator/appcontroller/pkg/generated/clientset/versioned/fake"
+)
+
+func newReplicaSet(deployment *appsv1.Deployment, revision int, image string) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        deployment.Name + "-" + strconv.Itoa(revision),
+			Namespace:   deployment.Namespace,
+			Labels:      deployment.Spec.Selector.MatchLabels,
+			Annotations: map[string]string{revisionAnnotation: strconv.Itoa(revision)},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment")),
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: deployment.Name, Image: image}},
+				},
+			},
+		},
+	}
+}
+
+func TestFindRevision(t *testing.T) {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: metav1.NamespaceDefault},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"controller": "test"}},
+		},
+	}
+	replicaSets := []*appsv1.ReplicaSet{
+		newReplicaSet(d, 1, "nginx:1.23"),
+		newReplicaSet(d, 3, "nginx:1.25"),
+		newReplicaSet(d, 2, "nginx:1.24"),
+	}
+
+	tests := []struct {
+		name       string
+		current    int64
+		toRevision int64
+		want       string
+		wantErr    bool
+	}{
+		{name: "previous", current: 3, want: "nginx:1.24"},
+		{name: "explicit", current: 3, toRevision: 1, want: "nginx:1.23"},
+		{name: "missing", current: 3, toRevision: 7, wantErr: true},
+		{name: "no history", current: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := findRevision(replicaSets, tt.current, tt.toRevision)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got revision %s", rs.Annotations[revisionAnnotation])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := containerImage(rs, d.Name); got != tt.want {
+				t.Errorf("got image %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollbackPatchesApp(t *testing.T) {
+	app := newApp(metav1.NamespaceDefault, "test", "nginx:1.25", "", 1)
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        app.Spec.Deployment.Name,
+			Namespace:   app.Namespace,
+			Annotations: map[string]string{revisionAnnotation: "2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"controller": app.Name}},
+		},
+	}
+	// Only ReplicaSets controlled by the Deployment take part in the rollback.
+	stray := newReplicaSet(d, 1, "busybox")
+	stray.OwnerReferences = nil
+	stray.Name = "stray"
+
+	out := &bytes.Buffer{}
+	appClient := fake.NewSimpleClientset(app)
+	c := &cli{
+		kubeClient: k8sfake.NewSimpleClientset(d, newReplicaSet(d, 1, "nginx:1.24"), newReplicaSet(d, 2, "nginx:1.25"), stray),
+		appClient:  appClient,
+		namespace:  metav1.NamespaceDefault,
+		out:        out,
+	}
+
+	if err := c.rollback(context.Background(), app.Name, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var patched bool
+	for _, action := range appClient.Actions() {
+		if action.GetVerb() != "patch" {
+			continue
+		}
+		patch := action.(interface{ GetPatchType() types.PatchType })
+		if patch.GetPatchType() != types.MergePatchType {
+			t.Errorf("expected merge patch, got %s", patch.GetPatchType())
+		}
+		patched = true
+	}
+	if !patched {
+		t.Fatalf("expected app to be patched, actions: %v", appClient.Actions())
+	}
+
+	got, err := appClient.AppcontrollerV1().Apps(app.Namespace).Get(context.Background(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Spec.Deployment.Image != "nginx:1.24" {
+		t.Errorf("got image %q, want %q", got.Spec.Deployment.Image, "nginx:1.24")
+	}
+}
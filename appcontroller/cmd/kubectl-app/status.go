@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
+)
+
+func runStatus(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("status", pflag.ContinueOnError)
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+	return c.status(ctx, names[0])
+}
+
+// status prints the App and its children as a tree, one line per object.
+func (c *cli) status(ctx context.Context, name string) error {
+	app, err := c.appClient.AppcontrollerV1().Apps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	lines := []string{
+		c.deploymentStatus(ctx, app),
+		c.serviceStatus(ctx, app),
+		c.ingressStatus(ctx, app),
+	}
+	fmt.Fprintf(c.out, "App %s/%s\n", app.Namespace, app.Name)
+	for i, line := range lines {
+		branch := "├── "
+		if i == len(lines)-1 {
+			branch = "└── "
+		}
+		fmt.Fprintf(c.out, "%s%s\n", branch, line)
+	}
+	return nil
+}
+
+func (c *cli) deploymentStatus(ctx context.Context, app *appv1.App) string {
+	name := app.Spec.Deployment.Name
+	d, err := c.kubeClient.AppsV1().Deployments(app.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return childError("Deployment", name, err)
+	}
+
+	var desired int32 = 1
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	state := "NotReady"
+	switch {
+	case d.Spec.Paused:
+		state = "Paused"
+	case d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < desired:
+		state = "Progressing"
+	case d.Status.ReadyReplicas >= desired:
+		state = "Ready"
+	}
+	return fmt.Sprintf("Deployment/%s  %s  %d/%d ready%s", d.Name, state, d.Status.ReadyReplicas, desired, unmanaged(app, d))
+}
+
+func (c *cli) serviceStatus(ctx context.Context, app *appv1.App) string {
+	name := app.Spec.Service.Name
+	s, err := c.kubeClient.CoreV1().Services(app.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return childError("Service", name, err)
+	}
+
+	var ports []string
+	for _, p := range s.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+	}
+	state := "NotReady"
+	if s.Spec.ClusterIP != "" {
+		state = "Ready"
+	}
+	return fmt.Sprintf("Service/%s  %s  %s %s%s", s.Name, state, s.Spec.ClusterIP, strings.Join(ports, ","), unmanaged(app, s))
+}
+
+func (c *cli) ingressStatus(ctx context.Context, app *appv1.App) string {
+	name := app.Spec.Ingress.Name
+	if name == "" {
+		return "Ingress  <not requested>"
+	}
+	ing, err := c.kubeClient.NetworkingV1().Ingresses(app.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return childError("Ingress", name, err)
+	}
+
+	var addresses []string
+	for _, lb := range ing.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		} else if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		}
+	}
+	state := "Ready"
+	if len(addresses) == 0 {
+		state = "NotReady"
+		addresses = []string{"<pending>"}
+	}
+	return fmt.Sprintf("Ingress/%s  %s  %s -> %s%s", ing.Name, state, app.Spec.Ingress.Hostname, strings.Join(addresses, ","), unmanaged(app, ing))
+}
+
+func childError(kind, name string, err error) string {
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("%s/%s  <not found>", kind, name)
+	}
+	return fmt.Sprintf("%s/%s  <error: %v>", kind, name, err)
+}
+
+// unmanaged flags children which exist but are not controlled by the App, as
+// the controller refuses to adopt them.
+func unmanaged(app *appv1.App, obj metav1.Object) string {
+	if metav1.IsControlledBy(obj, app) {
+		return ""
+	}
+	return "  (not managed by App)"
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
+)
+
+func runScale(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("scale", pflag.ContinueOnError)
+	replicas := fs.Int32("replicas", -1, "The desired number of replicas.")
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+	if *replicas < 0 {
+		return fmt.Errorf("--replicas must be specified and not negative")
+	}
+	return c.patchDeploymentSpec(ctx, names[0], "scaled", map[string]interface{}{"replicas": *replicas})
+}
+
+func runSetImage(ctx context.Context, args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("set image", pflag.ContinueOnError)
+	c, names, err := parse(fs, args, 2, out)
+	if err != nil {
+		return err
+	}
+	return c.patchDeploymentSpec(ctx, names[0], "image updated", map[string]interface{}{"image": names[1]})
+}
+
+func runSetPaused(ctx context.Context, args []string, out io.Writer, paused bool) error {
+	fs := pflag.NewFlagSet("pause", pflag.ContinueOnError)
+	c, names, err := parse(fs, args, 1, out)
+	if err != nil {
+		return err
+	}
+	verb := "resumed"
+	if paused {
+		verb = "paused"
+	}
+	return c.patchDeploymentSpec(ctx, names[0], verb, map[string]interface{}{"paused": paused})
+}
+
+// patchDeploymentSpec merges fields into spec.deployment of the named App. The
+// appcontroller then rolls the change out to the Deployment.
+func (c *cli) patchDeploymentSpec(ctx context.Context, name, verb string, fields map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"deployment": fields,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	app, err := c.appClient.AppcontrollerV1().Apps(c.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "app.%s/%s %s\n", appv1.SchemeGroupVersion.Group, app.Name, verb)
+	return nil
+}
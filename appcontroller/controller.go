@@ -24,9 +24,9 @@ import (
 	v13 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	appsinformers "k8s.io/client-go/informers/apps/v1"
 	v15 "k8s.io/client-go/informers/core/v1"
 	v12 "k8s.io/client-go/informers/networking/v1"
@@ -40,6 +40,9 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
@@ -51,6 +54,20 @@ import (
 
 const controllerAgentName = "appcontroller"
 
+// defaultShutdownGracePeriod is how long in-flight reconciles may run after
+// shutdown has been requested.
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// Log verbosity used by the controller. Lifecycle messages and errors are
+// always logged.
+const (
+	// logLevelChange is used for changes made to child resources and for the
+	// outcome of each sync.
+	logLevelChange = 2
+	// logLevelDebug is used for event handler and cache details.
+	logLevelDebug = 4
+)
+
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a App is synced
 	SuccessSynced = "Synced"
@@ -64,6 +81,18 @@ const (
 	// MessageResourceSynced is the message used for an Event fired when a App
 	// is synced successfully
 	MessageResourceSynced = "App synced successfully"
+
+	// DryRunCreate is used as part of the Event 'reason' when the controller
+	// runs in dry-run mode and would have created a resource.
+	DryRunCreate = "DryRunCreate"
+	// DryRunUpdate is used as part of the Event 'reason' when the controller
+	// runs in dry-run mode and would have updated a resource.
+	DryRunUpdate = "DryRunUpdate"
+	// MessageDryRun is the message used for dry-run Events
+	MessageDryRun = "Dry-run: would %s %s %q: %s"
+	// maxEventMessageLength keeps dry-run Events within the API limit. The full
+	// diff is always logged.
+	maxEventMessageLength = 1024
 )
 
 // Controller is the controller implementation for App resources
@@ -91,6 +120,22 @@ type Controller struct {
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
+	// dryRun makes the controller send every create and update with
+	// server-side dry-run and report the resulting changes instead of
+	// applying them.
+	dryRun bool
+	// shutdownGracePeriod is how long Run waits for in-flight reconciles to
+	// finish once its context is canceled, before canceling them.
+	shutdownGracePeriod time.Duration
+	// syncHandler reconciles the App of a workqueue key, it is syncApp
+	// outside of tests.
+	syncHandler func(ctx context.Context, key string) error
+
+	// processed, failed and canceled count the work items handled by the
+	// workers, for the summary logged on shutdown.
+	processed atomic.Int64
+	failed    atomic.Int64
+	canceled  atomic.Int64
 }
 
 // NewController returns a new sample controller
@@ -105,29 +150,32 @@ func NewController(
 	// Create event broadcaster
 	// Add sample-controller types to the default Kubernetes Scheme so Events can be
 	// logged for sample-controller types.
+	logger := klog.Background()
 	utilruntime.Must(appscheme.AddToScheme(scheme.Scheme))
-	klog.V(4).Info("Creating event broadcaster")
+	logger.V(logLevelDebug).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartStructuredLogging(0)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:     kubeclientset,
-		appclientset:      appclientset,
-		deploymentsLister: deploymentInformer.Lister(),
-		deploymentsSynced: deploymentInformer.Informer().HasSynced,
-		appsLister:        appInformer.Lister(),
-		appsSynced:        appInformer.Informer().HasSynced,
-		ingressLister:     ingressInformer.Lister(),
-		ingressSynced:     ingressInformer.Informer().HasSynced,
-		serviceLister:     serviceInformer.Lister(),
-		serviceSynced:     serviceInformer.Informer().HasSynced,
-		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Apps"),
-		recorder:          recorder,
-	}
-
-	klog.Info("Setting up event handlers")
+		kubeclientset:       kubeclientset,
+		appclientset:        appclientset,
+		deploymentsLister:   deploymentInformer.Lister(),
+		deploymentsSynced:   deploymentInformer.Informer().HasSynced,
+		appsLister:          appInformer.Lister(),
+		appsSynced:          appInformer.Informer().HasSynced,
+		ingressLister:       ingressInformer.Lister(),
+		ingressSynced:       ingressInformer.Informer().HasSynced,
+		serviceLister:       serviceInformer.Lister(),
+		serviceSynced:       serviceInformer.Informer().HasSynced,
+		workqueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Apps"),
+		recorder:            recorder,
+		shutdownGracePeriod: defaultShutdownGracePeriod,
+	}
+	controller.syncHandler = controller.syncApp
+
+	logger.Info("Setting up event handlers")
 	// Set up an event handler for when App resources change
 	appInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.enqueueApp,
@@ -141,71 +189,111 @@ func NewController(
 	// processing. This way, we don't need to implement custom logic for
 	// handling Deployment resources. More info on this pattern:
 	// https://github.com/kubernetes/community/blob/8cafef897a22026d42f5e5bb3f104febe7e29830/contributors/devel/controllers.md
-
-	//deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-	//	AddFunc: controller.handleObject,
-	//	UpdateFunc: func(old, new interface{}) {
-	//		newDepl := new.(*appsv1.Deployment)
-	//		oldDepl := old.(*appsv1.Deployment)
-	//		if newDepl.ResourceVersion == oldDepl.ResourceVersion {
-	//			// Periodic resync will send update events for all known Deployments.
-	//			// Two different versions of the same Deployment will always have different RVs.
-	//			return
-	//		}
-	//		controller.handleObject(new)
-	//	},
-	//	DeleteFunc: controller.handleObject,
-	//})
+	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newDepl := new.(*appsv1.Deployment)
+			oldDepl := old.(*appsv1.Deployment)
+			if newDepl.ResourceVersion == oldDepl.ResourceVersion {
+				// Periodic resync will send update events for all known Deployments.
+				// Two different versions of the same Deployment will always have different RVs.
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
 
 	return controller
 }
 
 // Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
-func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
+// as syncing informer caches and starting workers. It will block until ctx
+// is canceled, at which point it stops handing out work, waits up to
+// shutdownGracePeriod for in-flight reconciles to finish and then cancels the
+// remaining ones before returning.
+func (c *Controller) Run(ctx context.Context, workers int) error {
 	defer utilruntime.HandleCrash()
 	defer c.workqueue.ShutDown()
+	logger := klog.FromContext(ctx)
 
 	// Start the informer factories to begin populating the informer caches
-	klog.Info("Starting App controller")
+	logger.Info("Starting App controller")
 
 	// Wait for the caches to be synced before starting workers
-	klog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.appsSynced, c.ingressSynced, c.serviceSynced); !ok {
+	logger.Info("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.appsSynced, c.ingressSynced, c.serviceSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
-	klog.Info("Starting workers")
-	// Launch two workers to process App resources
-	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
-	}
-
-	klog.Info("Started workers")
-	<-stopCh
-	klog.Info("Shutting down workers")
+	// Reconciles run with their own context so that canceling ctx stops new
+	// work without aborting the requests already in flight.
+	workCtx, cancelWork := context.WithCancel(klog.NewContext(context.Background(), logger))
+	defer cancelWork()
 
+	logger.Info("Starting workers", "count", workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runWorker(workCtx)
+		}()
+	}
+
+	logger.Info("Started workers")
+	<-ctx.Done()
+	logger.Info("Shutting down workers", "gracePeriod", c.shutdownGracePeriod)
+	// Wake up idle workers. Busy workers stop after their current item.
+	c.workqueue.ShutDown()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(c.shutdownGracePeriod):
+		logger.Info("Grace period expired, canceling in-flight reconciles")
+		cancelWork()
+		<-drained
+	}
+
+	logger.Info("Shut down workers",
+		"processed", c.processed.Load(),
+		"failed", c.failed.Load(),
+		"canceled", c.canceled.Load(),
+		"dropped", c.workqueue.Len())
 	return nil
 }
 
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
-func (c *Controller) runWorker() {
-	for c.processNextWorkItem() {
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
 	}
 }
 
 // processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it, by calling the syncHandler.
-func (c *Controller) processNextWorkItem() bool {
+// attempt to process it, by calling the syncHandler. Every attempt gets its
+// own reconcile ID, which is attached to the logger passed to syncHandler.
+// It returns false once the workqueue is shutting down.
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	obj, shutdown := c.workqueue.Get()
 
 	if shutdown {
 		return false
 	}
+	// The workqueue still hands out queued items after ShutDown. Leave them,
+	// they are picked up again from the informer caches on the next start.
+	if c.workqueue.ShuttingDown() {
+		c.workqueue.Done(obj)
+		return false
+	}
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), "reconcileID", newReconcileID())
+	ctx = klog.NewContext(ctx, logger)
 
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
@@ -229,41 +317,50 @@ func (c *Controller) processNextWorkItem() bool {
 			// Forget here else we'd go into a loop of attempting to
 			// process a work item that is invalid.
 			c.workqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
-			return nil
+			return fmt.Errorf("expected string in workqueue but got %#v", obj)
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// App resource to be synced.
-		if err := c.syncHandler(key); err != nil {
+		if err := c.syncHandler(ctx, key); err != nil {
+			if ctx.Err() != nil {
+				c.canceled.Add(1)
+				return fmt.Errorf("syncing %q canceled: %w", key, err)
+			}
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			c.failed.Add(1)
+			return fmt.Errorf("error syncing %q, requeuing: %w", key, err)
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
+		c.processed.Add(1)
+		logger.V(logLevelChange).Info("Successfully synced", "key", key)
 		return nil
 	}(obj)
 
 	if err != nil {
-		utilruntime.HandleError(err)
+		logger.Error(err, "Error processing work item")
 		return true
 	}
 
 	return true
 }
 
-// syncHandler compares the actual state with the desired, and attempts to
+// syncApp compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the App resource
-// with the current status of the resource.
-func (c *Controller) syncHandler(key string) error {
+// with the current status of the resource. The logger in ctx is extended with
+// the App reference and handed down to each sync function.
+func (c *Controller) syncApp(ctx context.Context, key string) error {
+	logger := klog.FromContext(ctx)
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		logger.Error(err, "Invalid resource key", "key", key)
 		return nil
 	}
+	logger = klog.LoggerWithValues(logger, "app", klog.KRef(namespace, name))
+	ctx = klog.NewContext(ctx, logger)
 
 	// Get the App resource with this namespace/name
 	app, err := c.appsLister.Apps(namespace).Get(name)
@@ -271,39 +368,42 @@ func (c *Controller) syncHandler(key string) error {
 		// The App resource may no longer exist, in which case we stop
 		// processing.
 		if errors.IsNotFound(err) {
-			utilruntime.HandleError(fmt.Errorf("foo '%s' in work queue no longer exists", key))
+			logger.V(logLevelChange).Info("App in work queue no longer exists")
 			return nil
 		}
 
 		return err
 	}
 
-	err = c.syncDeployment(key, app)
+	err = c.syncDeployment(ctx, app)
 	if err != nil {
 		return err
 	}
 
-	err = c.syncService(key, app)
+	err = c.syncService(ctx, app)
 	if err != nil {
 		return err
 	}
 
-	err = c.syncIngress(key, app)
+	err = c.syncIngress(ctx, app)
 	if err != nil {
 		return err
 	}
 
-	c.recorder.Event(app, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	if !c.dryRun {
+		c.recorder.Event(app, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	}
 	return nil
 }
 
-func (c *Controller) syncDeployment(key string, app *appv1.App) error {
+func (c *Controller) syncDeployment(ctx context.Context, app *appv1.App) error {
+	logger := klog.FromContext(ctx)
 	deploymentName := app.Spec.Deployment.Name
 	if deploymentName == "" {
 		// We choose to absorb the error here as the worker would requeue the
 		// resource otherwise. Instead, the next time the resource is updated
 		// the resource will be queued again.
-		utilruntime.HandleError(fmt.Errorf("%s: deployment name must be specified", key))
+		logger.Error(nil, "Deployment name must be specified")
 		return nil
 	}
 
@@ -311,7 +411,11 @@ func (c *Controller) syncDeployment(key string, app *appv1.App) error {
 	deployment, err := c.deploymentsLister.Deployments(app.Namespace).Get(deploymentName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		deployment, err = c.kubeclientset.AppsV1().Deployments(app.Namespace).Create(context.TODO(), newDeployment(app), metav1.CreateOptions{})
+		logger.V(logLevelChange).Info("Creating deployment", "deployment", klog.KRef(app.Namespace, deploymentName))
+		deployment, err = c.kubeclientset.AppsV1().Deployments(app.Namespace).Create(ctx, newDeployment(app), c.createOptions())
+		if err == nil {
+			c.reportDryRun(ctx, app, "create", "Deployment", deploymentName, nil, deployment)
+		}
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
@@ -329,12 +433,16 @@ func (c *Controller) syncDeployment(key string, app *appv1.App) error {
 		return fmt.Errorf("%s", msg)
 	}
 
-	// If this number of the replicas on the App resource is specified, and the
-	// number does not equal the current desired replicas on the Deployment, we
-	// should update the Deployment resource.
-	if app.Spec.Deployment.Replicas != nil && *app.Spec.Deployment.Replicas != *deployment.Spec.Replicas {
-		klog.V(4).Infof("App %s replicas: %d, deployment replicas: %d", app.Name, *app.Spec.Deployment.Replicas, *deployment.Spec.Replicas)
-		deployment, err = c.kubeclientset.AppsV1().Deployments(app.Namespace).Update(context.TODO(), newDeployment(app), metav1.UpdateOptions{})
+	// If the replicas, image or paused state on the App resource do not match
+	// the current Deployment, we should update the Deployment resource.
+	if deploymentNeedsUpdate(app, deployment) {
+		logger.V(logLevelChange).Info("Updating deployment", "deployment", klog.KObj(deployment))
+		var updated *appsv1.Deployment
+		updated, err = c.kubeclientset.AppsV1().Deployments(app.Namespace).Update(ctx, newDeployment(app), c.updateOptions())
+		if err == nil {
+			c.reportDryRun(ctx, app, "update", "Deployment", deploymentName, deployment, updated)
+		}
+		deployment = updated
 	}
 
 	// If an error occurs during Update, we'll requeue the item so we can
@@ -345,22 +453,40 @@ func (c *Controller) syncDeployment(key string, app *appv1.App) error {
 	}
 
 	// Finally, we update the status block of the App resource to reflect the
-	// current state of the world
-	//err = c.updateAppStatus(app, deployment)
-	//if err != nil {
-	//	return err
-	//}
+	// current state of the world. A dry-run Deployment is not the state of the
+	// world, so the status is left alone in dry-run mode.
+	if c.dryRun {
+		return nil
+	}
+	return c.updateAppStatus(ctx, app, deployment)
+}
 
-	return nil
+// deploymentNeedsUpdate reports whether the fields of the Deployment that are
+// driven by the App resource have drifted from the App spec.
+func deploymentNeedsUpdate(app *appv1.App, deployment *appsv1.Deployment) bool {
+	if app.Spec.Deployment.Replicas != nil &&
+		(deployment.Spec.Replicas == nil || *app.Spec.Deployment.Replicas != *deployment.Spec.Replicas) {
+		return true
+	}
+	if app.Spec.Deployment.Paused != deployment.Spec.Paused {
+		return true
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == app.Spec.Deployment.Name {
+			return container.Image != app.Spec.Deployment.Image
+		}
+	}
+	return true
 }
 
-func (c *Controller) syncService(key string, app *appv1.App) error {
+func (c *Controller) syncService(ctx context.Context, app *appv1.App) error {
+	logger := klog.FromContext(ctx)
 	serviceName := app.Spec.Service.Name
 	if serviceName == "" {
 		// We choose to absorb the error here as the worker would requeue the
 		// resource otherwise. Instead, the next time the resource is updated
 		// the resource will be queued again.
-		utilruntime.HandleError(fmt.Errorf("%s: service name must be specified", key))
+		logger.Error(nil, "Service name must be specified")
 		return nil
 	}
 
@@ -368,7 +494,11 @@ func (c *Controller) syncService(key string, app *appv1.App) error {
 	service, err := c.serviceLister.Services(app.Namespace).Get(serviceName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		service, err = c.kubeclientset.CoreV1().Services(app.Namespace).Create(context.TODO(), newService(app), metav1.CreateOptions{})
+		logger.V(logLevelChange).Info("Creating service", "service", klog.KRef(app.Namespace, serviceName))
+		service, err = c.kubeclientset.CoreV1().Services(app.Namespace).Create(ctx, newService(app), c.createOptions())
+		if err == nil {
+			c.reportDryRun(ctx, app, "create", "Service", serviceName, nil, service)
+		}
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
@@ -389,14 +519,21 @@ func (c *Controller) syncService(key string, app *appv1.App) error {
 	return nil
 }
 
-func (c *Controller) syncIngress(key string, app *appv1.App) error {
+func (c *Controller) syncIngress(ctx context.Context, app *appv1.App) error {
+	logger := klog.FromContext(ctx)
 	ingressName := app.Spec.Ingress.Name
 	ingressHostname := app.Spec.Ingress.Hostname
+	if ingressName == "" && ingressHostname == "" {
+		// The App does not ask for an Ingress, e.g. it was made by
+		// "kubectl app create" without --host.
+		logger.V(logLevelDebug).Info("No ingress requested")
+		return nil
+	}
 	if ingressName == "" {
 		// We choose to absorb the error here as the worker would requeue the
 		// resource otherwise. Instead, the next time the resource is updated
 		// the resource will be queued again.
-		utilruntime.HandleError(fmt.Errorf("%s: ingress name must be specified", key))
+		logger.Error(nil, "Ingress name must be specified")
 		return nil
 	}
 
@@ -404,7 +541,7 @@ func (c *Controller) syncIngress(key string, app *appv1.App) error {
 		// We choose to absorb the error here as the worker would requeue the
 		// resource otherwise. Instead, the next time the resource is updated
 		// the resource will be queued again.
-		utilruntime.HandleError(fmt.Errorf("%s: ingress hostname must be specified", key))
+		logger.Error(nil, "Ingress hostname must be specified")
 		return nil
 	}
 
@@ -412,7 +549,11 @@ func (c *Controller) syncIngress(key string, app *appv1.App) error {
 	ingress, err := c.ingressLister.Ingresses(app.Namespace).Get(ingressName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		ingress, err = c.kubeclientset.NetworkingV1().Ingresses(app.Namespace).Create(context.TODO(), newIngress(app), metav1.CreateOptions{})
+		logger.V(logLevelChange).Info("Creating ingress", "ingress", klog.KRef(app.Namespace, ingressName))
+		ingress, err = c.kubeclientset.NetworkingV1().Ingresses(app.Namespace).Create(ctx, newIngress(app), c.createOptions())
+		if err == nil {
+			c.reportDryRun(ctx, app, "create", "Ingress", ingressName, nil, ingress)
+		}
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
@@ -433,17 +574,80 @@ func (c *Controller) syncIngress(key string, app *appv1.App) error {
 	return nil
 }
 
-func (c *Controller) updateAppStatus(app *appv1.App, deployment *appsv1.Deployment) error {
+// createOptions returns the options for creating child resources, asking the
+// API server for a dry-run when the controller runs in dry-run mode.
+func (c *Controller) createOptions() metav1.CreateOptions {
+	if c.dryRun {
+		return metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.CreateOptions{}
+}
+
+// updateOptions returns the options for updating child resources, asking the
+// API server for a dry-run when the controller runs in dry-run mode.
+func (c *Controller) updateOptions() metav1.UpdateOptions {
+	if c.dryRun {
+		return metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.UpdateOptions{}
+}
+
+// reportDryRun logs the field-level diff between the current object and the
+// result of a dry-run request and records it as an Event on the App. It does
+// nothing unless the controller runs in dry-run mode. current is nil for
+// creates.
+func (c *Controller) reportDryRun(ctx context.Context, app *appv1.App, verb, kind, name string, current, result runtime.Object) {
+	if !c.dryRun {
+		return
+	}
+	logger := klog.FromContext(ctx)
+	lines, err := fieldDiff(current, result)
+	if err != nil {
+		logger.Error(err, "Error computing dry-run diff", "kind", kind, "name", name)
+		return
+	}
+	logger.Info("Dry-run", "verb", verb, "kind", kind, "name", name, "diff", lines)
+
+	reason := DryRunUpdate
+	summary := strings.Join(lines, "; ")
+	if verb == "create" {
+		reason = DryRunCreate
+		summary = fmt.Sprintf("%d fields set", len(lines))
+	}
+	msg := fmt.Sprintf(MessageDryRun, verb, kind, name, summary)
+	if len(msg) > maxEventMessageLength {
+		msg = msg[:maxEventMessageLength-3] + "..."
+	}
+	c.recorder.Event(app, corev1.EventTypeNormal, reason, msg)
+}
+
+// updateAppStatus copies the replicas, available replicas and pod selector of
+// the Deployment to the status of the App, if they differ. The replicas and
+// selector back the scale subresource, so HPAs can target the App.
+func (c *Controller) updateAppStatus(ctx context.Context, app *appv1.App, deployment *appsv1.Deployment) error {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector of deployment %s: %v", deployment.Name, err)
+	}
+	status := appv1.AppStatus{
+		AvailableReplicas: deployment.Status.AvailableReplicas,
+		Replicas:          deployment.Status.Replicas,
+		Selector:          selector.String(),
+	}
+	if app.Status == status {
+		return nil
+	}
+	klog.FromContext(ctx).V(logLevelChange).Info("Updating app status", "replicas", status.Replicas, "availableReplicas", status.AvailableReplicas)
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	appCopy := app.DeepCopy()
-	appCopy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	appCopy.Status = status
 	// If the CustomResourceSubresources feature gate is not enabled,
 	// we must use Update instead of UpdateStatus to update the Status block of the App resource.
 	// UpdateStatus will not allow changes to the Spec of the resource,
 	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err := c.appclientset.AppcontrollerV1().Apps(app.Namespace).UpdateStatus(context.TODO(), appCopy, metav1.UpdateOptions{})
+	_, err = c.appclientset.AppcontrollerV1().Apps(app.Namespace).UpdateStatus(ctx, appCopy, metav1.UpdateOptions{})
 	return err
 }
 
@@ -454,7 +658,7 @@ func (c *Controller) enqueueApp(obj interface{}) {
 	var key string
 	var err error
 	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
-		utilruntime.HandleError(err)
+		klog.Background().Error(err, "Error getting key for App")
 		return
 	}
 	c.workqueue.Add(key)
@@ -466,22 +670,23 @@ func (c *Controller) enqueueApp(obj interface{}) {
 // It then enqueues that App resource to be processed. If the object does not
 // have an appropriate OwnerReference, it will simply be skipped.
 func (c *Controller) handleObject(obj interface{}) {
+	logger := klog.Background()
 	var object metav1.Object
 	var ok bool
 	if object, ok = obj.(metav1.Object); !ok {
 		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 		if !ok {
-			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			logger.Error(nil, "Error decoding object, invalid type", "type", fmt.Sprintf("%T", obj))
 			return
 		}
 		object, ok = tombstone.Obj.(metav1.Object)
 		if !ok {
-			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			logger.Error(nil, "Error decoding object tombstone, invalid type", "type", fmt.Sprintf("%T", tombstone.Obj))
 			return
 		}
-		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
+		logger.V(logLevelDebug).Info("Recovered deleted object from tombstone", "object", klog.KObj(object))
 	}
-	klog.V(4).Infof("Processing object: %s", object.GetName())
+	logger.V(logLevelDebug).Info("Processing object", "object", klog.KObj(object))
 	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
 		// If this object is not owned by a App, we should not do anything more
 		// with it.
@@ -491,7 +696,7 @@ func (c *Controller) handleObject(obj interface{}) {
 
 		app, err := c.appsLister.Apps(object.GetNamespace()).Get(ownerRef.Name)
 		if err != nil {
-			klog.V(4).Infof("ignoring orphaned object '%s/%s' of foo '%s'", object.GetNamespace(), object.GetName(), ownerRef.Name)
+			logger.V(logLevelDebug).Info("Ignoring orphaned object", "object", klog.KObj(object), "app", ownerRef.Name)
 			return
 		}
 
@@ -518,6 +723,7 @@ func newDeployment(app *appv1.App) *appsv1.Deployment {
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: app.Spec.Deployment.Replicas,
+			Paused:   app.Spec.Deployment.Paused,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
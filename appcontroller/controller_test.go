@@ -17,25 +17,32 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
 	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 
-	samplecontroller "github.com/2456868764/appcontroller/pkg/apis/appcontroller/v1"
-	"github.com/2456868764/appcontroller/pkg/generated/clientset/versioned/fake"
-	informers "github.com/2456868764/appcontroller/pkg/generated/informers/externalversions"
+	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
+	"github.com/2456868764/operator/appcontroller/pkg/generated/clientset/versioned/fake"
+	informers "github.com/2456868764/operator/appcontroller/pkg/generated/informers/externalversions"
 )
 
 var (
@@ -49,14 +56,22 @@ type fixture struct {
 	client     *fake.Clientset
 	kubeclient *k8sfake.Clientset
 	// Objects to put in the store.
-	fooLister        []*samplecontroller.Foo
+	appLister        []*appv1.App
 	deploymentLister []*apps.Deployment
+	serviceLister    []*corev1.Service
+	ingressLister    []*networkingv1.Ingress
 	// Actions expected to happen on the client.
 	kubeactions []core.Action
 	actions     []core.Action
 	// Objects from here preloaded into NewSimpleFake.
 	kubeobjects []runtime.Object
 	objects     []runtime.Object
+	// dryRun runs the controller in dry-run mode.
+	dryRun bool
+	// recorder receives the Events recorded by the controller, if set.
+	recorder *record.FakeRecorder
+	// logs receives the log lines of the sync, if set.
+	logs *[]string
 }
 
 func newFixture(t *testing.T) *fixture {
@@ -67,16 +82,26 @@ func newFixture(t *testing.T) *fixture {
 	return f
 }
 
-func newFoo(name string, replicas *int32) *samplecontroller.Foo {
-	return &samplecontroller.Foo{
-		TypeMeta: metav1.TypeMeta{APIVersion: samplecontroller.SchemeGroupVersion.String()},
+func newApp(name string, replicas *int32) *appv1.App {
+	return &appv1.App{
+		TypeMeta: metav1.TypeMeta{APIVersion: appv1.SchemeGroupVersion.String()},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: metav1.NamespaceDefault,
 		},
-		Spec: samplecontroller.FooSpec{
-			DeploymentName: fmt.Sprintf("%s-deployment", name),
-			Replicas:       replicas,
+		Spec: appv1.AppSpec{
+			Deployment: appv1.DeploymentSpec{
+				Name:     fmt.Sprintf("%s-deployment", name),
+				Image:    "nginx:latest",
+				Replicas: replicas,
+			},
+			Service: appv1.ServiceSpec{
+				Name: fmt.Sprintf("%s-service", name),
+			},
+			Ingress: appv1.IngressSpec{
+				Name:     fmt.Sprintf("%s-ingress", name),
+				Hostname: fmt.Sprintf("%s.example.com", name),
+			},
 		},
 	}
 }
@@ -89,32 +114,49 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory,
 	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
 
 	c := NewController(f.kubeclient, f.client,
-		k8sI.Apps().V1().Deployments(), i.Samplecontroller().V1alpha1().Foos())
+		k8sI.Apps().V1().Deployments(),
+		k8sI.Core().V1().Services(),
+		i.Appcontroller().V1().Apps(),
+		k8sI.Networking().V1().Ingresses())
 
-	c.foosSynced = alwaysReady
+	c.appsSynced = alwaysReady
 	c.deploymentsSynced = alwaysReady
+	c.serviceSynced = alwaysReady
+	c.ingressSynced = alwaysReady
 	c.recorder = &record.FakeRecorder{}
+	if f.recorder != nil {
+		c.recorder = f.recorder
+	}
+	c.dryRun = f.dryRun
 
-	for _, f := range f.fooLister {
-		i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Add(f)
+	for _, a := range f.appLister {
+		i.Appcontroller().V1().Apps().Informer().GetIndexer().Add(a)
 	}
 
 	for _, d := range f.deploymentLister {
 		k8sI.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
 	}
 
+	for _, s := range f.serviceLister {
+		k8sI.Core().V1().Services().Informer().GetIndexer().Add(s)
+	}
+
+	for _, ing := range f.ingressLister {
+		k8sI.Networking().V1().Ingresses().Informer().GetIndexer().Add(ing)
+	}
+
 	return c, i, k8sI
 }
 
-func (f *fixture) run(fooName string) {
-	f.runController(fooName, true, false)
+func (f *fixture) run(appName string) {
+	f.runController(appName, true, false)
 }
 
-func (f *fixture) runExpectError(fooName string) {
-	f.runController(fooName, true, true)
+func (f *fixture) runExpectError(appName string) {
+	f.runController(appName, true, true)
 }
 
-func (f *fixture) runController(fooName string, startInformers bool, expectError bool) {
+func (f *fixture) runController(appName string, startInformers bool, expectError bool) {
 	c, i, k8sI := f.newController()
 	if startInformers {
 		stopCh := make(chan struct{})
@@ -123,11 +165,17 @@ func (f *fixture) runController(fooName string, startInformers bool, expectError
 		k8sI.Start(stopCh)
 	}
 
-	err := c.syncHandler(fooName)
+	ctx := context.Background()
+	if f.logs != nil {
+		ctx = klog.NewContext(ctx, funcr.New(func(prefix, args string) {
+			*f.logs = append(*f.logs, args)
+		}, funcr.Options{}))
+	}
+	err := c.syncHandler(ctx, appName)
 	if !expectError && err != nil {
-		f.t.Errorf("error syncing foo: %v", err)
+		f.t.Errorf("error syncing app: %v", err)
 	} else if expectError && err == nil {
-		f.t.Error("expected error syncing foo, got nil")
+		f.t.Error("expected error syncing app, got nil")
 	}
 
 	actions := filterInformerActions(f.client.Actions())
@@ -215,10 +263,14 @@ func filterInformerActions(actions []core.Action) []core.Action {
 	ret := []core.Action{}
 	for _, action := range actions {
 		if len(action.GetNamespace()) == 0 &&
-			(action.Matches("list", "foos") ||
-				action.Matches("watch", "foos") ||
+			(action.Matches("list", "apps") ||
+				action.Matches("watch", "apps") ||
 				action.Matches("list", "deployments") ||
-				action.Matches("watch", "deployments")) {
+				action.Matches("watch", "deployments") ||
+				action.Matches("list", "services") ||
+				action.Matches("watch", "services") ||
+				action.Matches("list", "ingresses") ||
+				action.Matches("watch", "ingresses")) {
 			continue
 		}
 		ret = append(ret, action)
@@ -235,80 +287,334 @@ func (f *fixture) expectUpdateDeploymentAction(d *apps.Deployment) {
 	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
 }
 
-func (f *fixture) expectUpdateFooStatusAction(foo *samplecontroller.Foo) {
-	action := core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "foos"}, "status", foo.Namespace, foo)
-	f.actions = append(f.actions, action)
+func (f *fixture) expectCreateServiceAction(s *corev1.Service) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "services"}, s.Namespace, s))
+}
+
+func (f *fixture) expectCreateIngressAction(ing *networkingv1.Ingress) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "ingresses"}, ing.Namespace, ing))
+}
+
+func (f *fixture) expectUpdateAppStatusAction(app *appv1.App) {
+	f.actions = append(f.actions, core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "apps"}, "status", app.Namespace, app))
 }
 
-func getKey(foo *samplecontroller.Foo, t *testing.T) string {
-	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(foo)
+func getKey(app *appv1.App, t *testing.T) string {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(app)
 	if err != nil {
-		t.Errorf("Unexpected error getting key for foo %v: %v", foo.Name, err)
+		t.Errorf("Unexpected error getting key for app %v: %v", app.Name, err)
 		return ""
 	}
 	return key
 }
 
-func TestCreatesDeployment(t *testing.T) {
+func TestCreatesChildren(t *testing.T) {
 	f := newFixture(t)
-	foo := newFoo("test", int32Ptr(1))
+	app := newApp("test", int32Ptr(1))
 
-	f.fooLister = append(f.fooLister, foo)
-	f.objects = append(f.objects, foo)
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
 
-	expDeployment := newDeployment(foo)
-	f.expectCreateDeploymentAction(expDeployment)
-	f.expectUpdateFooStatusAction(foo)
+	f.expectCreateDeploymentAction(newDeployment(app))
+	f.expectCreateServiceAction(newService(app))
+	f.expectCreateIngressAction(newIngress(app))
 
-	f.run(getKey(foo, t))
+	expApp := app.DeepCopy()
+	expApp.Status.Selector = "app=app,controller=test"
+	f.expectUpdateAppStatusAction(expApp)
+
+	f.run(getKey(app, t))
 }
 
-func TestDoNothing(t *testing.T) {
+func TestCreatesChildrenWithoutIngress(t *testing.T) {
 	f := newFixture(t)
-	foo := newFoo("test", int32Ptr(1))
-	d := newDeployment(foo)
+	f.recorder = record.NewFakeRecorder(10)
+	f.logs = &[]string{}
+	// "kubectl app create" without --host leaves the ingress empty.
+	app := newApp("test", int32Ptr(1))
+	app.Spec.Ingress = appv1.IngressSpec{}
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+
+	f.expectCreateDeploymentAction(newDeployment(app))
+	f.expectCreateServiceAction(newService(app))
+
+	expApp := app.DeepCopy()
+	expApp.Status.Selector = "app=app,controller=test"
+	f.expectUpdateAppStatusAction(expApp)
+
+	f.run(getKey(app, t))
+
+	select {
+	case event := <-f.recorder.Events:
+		if want := "Normal Synced App synced successfully"; event != want {
+			t.Errorf("got event %q, want %q", event, want)
+		}
+	default:
+		t.Error("expected a synced event, got none")
+	}
+	for _, line := range *f.logs {
+		if strings.Contains(line, `"error"`) {
+			t.Errorf("unexpected error logged: %s", line)
+		}
+	}
+}
 
-	f.fooLister = append(f.fooLister, foo)
-	f.objects = append(f.objects, foo)
+func TestDoNothing(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(1))
+	app.Status.Selector = "app=app,controller=test"
+	d := newDeployment(app)
+	s := newService(app)
+	ing := newIngress(app)
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
 	f.deploymentLister = append(f.deploymentLister, d)
-	f.kubeobjects = append(f.kubeobjects, d)
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
 
-	f.expectUpdateFooStatusAction(foo)
-	f.run(getKey(foo, t))
+	f.run(getKey(app, t))
 }
 
 func TestUpdateDeployment(t *testing.T) {
 	f := newFixture(t)
-	foo := newFoo("test", int32Ptr(1))
-	d := newDeployment(foo)
+	app := newApp("test", int32Ptr(1))
+	app.Status.Selector = "app=app,controller=test"
+	d := newDeployment(app)
+	s := newService(app)
+	ing := newIngress(app)
 
 	// Update replicas
-	foo.Spec.Replicas = int32Ptr(2)
-	expDeployment := newDeployment(foo)
+	app.Spec.Deployment.Replicas = int32Ptr(2)
+	expDeployment := newDeployment(app)
 
-	f.fooLister = append(f.fooLister, foo)
-	f.objects = append(f.objects, foo)
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
 	f.deploymentLister = append(f.deploymentLister, d)
-	f.kubeobjects = append(f.kubeobjects, d)
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
+
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(app, t))
+}
+
+func TestUpdateDeploymentImage(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(1))
+	app.Status.Selector = "app=app,controller=test"
+	d := newDeployment(app)
+	s := newService(app)
+	ing := newIngress(app)
+
+	// Update image and pause the rollout
+	app.Spec.Deployment.Image = "nginx:1.25"
+	app.Spec.Deployment.Paused = true
+	expDeployment := newDeployment(app)
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
+
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(app, t))
+}
+
+func TestUpdateStatus(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(2))
+	d := newDeployment(app)
+	d.Status.Replicas = 2
+	d.Status.AvailableReplicas = 1
+	s := newService(app)
+	ing := newIngress(app)
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
+
+	expApp := app.DeepCopy()
+	expApp.Status = appv1.AppStatus{AvailableReplicas: 1, Replicas: 2, Selector: "app=app,controller=test"}
+	f.expectUpdateAppStatusAction(expApp)
+	f.run(getKey(app, t))
+}
+
+func TestDryRunUpdateDeployment(t *testing.T) {
+	f := newFixture(t)
+	f.dryRun = true
+	f.recorder = record.NewFakeRecorder(10)
+	app := newApp("test", int32Ptr(1))
+	app.Status.Selector = "app=app,controller=test"
+	d := newDeployment(app)
+	s := newService(app)
+	ing := newIngress(app)
+
+	app.Spec.Deployment.Replicas = int32Ptr(2)
+	expDeployment := newDeployment(app)
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
 
-	f.expectUpdateFooStatusAction(foo)
 	f.expectUpdateDeploymentAction(expDeployment)
-	f.run(getKey(foo, t))
+	f.run(getKey(app, t))
+
+	select {
+	case event := <-f.recorder.Events:
+		want := `Normal DryRunUpdate Dry-run: would update Deployment "test-deployment": spec.replicas: 1 -> 2`
+		if event != want {
+			t.Errorf("got event %q, want %q", event, want)
+		}
+	default:
+		t.Error("expected a dry-run event, got none")
+	}
+	select {
+	case event := <-f.recorder.Events:
+		t.Errorf("unexpected event %q", event)
+	default:
+	}
+}
+
+func TestRunDrainsOnShutdown(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(1))
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+
+	c, _, _ := f.newController()
+	c.enqueueApp(app)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, 2) }()
+
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return c.processed.Load() == 1, nil
+	}); err != nil {
+		t.Fatalf("app was not synced: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+}
+
+func TestRunCancelsInFlightAfterGracePeriod(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(1))
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+
+	c, _, _ := f.newController()
+	c.shutdownGracePeriod = 10 * time.Millisecond
+	// The handler signals it is in flight and then blocks until Run cancels
+	// its context once the grace period expired.
+	started := make(chan struct{})
+	c.syncHandler = func(ctx context.Context, key string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	c.enqueueApp(app)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, 1) }()
+
+	select {
+	case <-started:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("the app was not handed to a worker")
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+	if got := c.canceled.Load(); got != 1 {
+		t.Errorf("expected 1 canceled reconcile, got %d", got)
+	}
+	if got := c.failed.Load(); got != 0 {
+		t.Errorf("expected no failed reconciles, got %d", got)
+	}
+}
+
+func TestDeploymentStatusChangeRequeuesApp(t *testing.T) {
+	f := newFixture(t)
+	app := newApp("test", int32Ptr(2))
+	d := newDeployment(app)
+	d.ResourceVersion = "1"
+
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	c, _, k8sI := f.newController()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	k8sI.Start(stopCh)
+	k8sI.WaitForCacheSync(stopCh)
+
+	// The initial add of the Deployment enqueues its App once.
+	waitForApp := func() {
+		t.Helper()
+		if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			return c.workqueue.Len() == 1, nil
+		}); err != nil {
+			t.Fatalf("app was not enqueued: %v", err)
+		}
+		key, _ := c.workqueue.Get()
+		if key != getKey(app, t) {
+			t.Errorf("expected key %q, got %q", getKey(app, t), key)
+		}
+		c.workqueue.Forget(key)
+		c.workqueue.Done(key)
+	}
+	waitForApp()
+
+	d = d.DeepCopy()
+	d.ResourceVersion = "2"
+	d.Status.Replicas = 2
+	d.Status.AvailableReplicas = 2
+	if _, err := f.kubeclient.AppsV1().Deployments(d.Namespace).UpdateStatus(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("error updating deployment status: %v", err)
+	}
+	waitForApp()
 }
 
 func TestNotControlledByUs(t *testing.T) {
 	f := newFixture(t)
-	foo := newFoo("test", int32Ptr(1))
-	d := newDeployment(foo)
+	app := newApp("test", int32Ptr(1))
+	d := newDeployment(app)
 
 	d.ObjectMeta.OwnerReferences = []metav1.OwnerReference{}
 
-	f.fooLister = append(f.fooLister, foo)
-	f.objects = append(f.objects, foo)
+	f.appLister = append(f.appLister, app)
+	f.objects = append(f.objects, app)
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
 
-	f.runExpectError(getKey(foo, t))
+	f.runExpectError(getKey(app, t))
 }
 
 func int32Ptr(i int32) *int32 { return &i }
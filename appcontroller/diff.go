@@ -0,0 +1,148 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ignoredFields are maintained by the API server and would show up in every
+// diff between a cached object and a server response.
+var ignoredFields = [][]string{
+	{"metadata", "creationTimestamp"},
+	{"metadata", "generation"},
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"status"},
+}
+
+// fieldDiff returns one line per field that differs between oldObj and newObj,
+// in the form "path: old -> new". Either object may be nil, in which case
+// every field of the other one is reported.
+func fieldDiff(oldObj, newObj runtime.Object) ([]string, error) {
+	oldMap, err := toDiffable(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	newMap, err := toDiffable(newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	diffValues("", oldMap, newMap, &lines)
+	return lines, nil
+}
+
+func toDiffable(obj runtime.Object) (map[string]interface{}, error) {
+	if obj == nil || reflect.ValueOf(obj).IsNil() {
+		return map[string]interface{}{}, nil
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range ignoredFields {
+		removeField(m, path)
+	}
+	return m, nil
+}
+
+func removeField(m map[string]interface{}, path []string) {
+	for i, key := range path {
+		if i == len(path)-1 {
+			delete(m, key)
+			return
+		}
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+}
+
+func diffValues(path string, oldValue, newValue interface{}, lines *[]string) {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	// Descend into objects which are only present on one side, so that each
+	// added or removed field is reported on its own line.
+	if oldValue == nil && newIsMap {
+		oldMap, oldIsMap = map[string]interface{}{}, true
+	}
+	if newValue == nil && oldIsMap {
+		newMap, newIsMap = map[string]interface{}{}, true
+	}
+	if oldIsMap && newIsMap {
+		keys := map[string]bool{}
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinPath(path, k), oldMap[k], newMap[k], lines)
+		}
+		return
+	}
+
+	oldSlice, oldIsSlice := oldValue.([]interface{})
+	newSlice, newIsSlice := newValue.([]interface{})
+	if oldIsSlice && newIsSlice && len(oldSlice) == len(newSlice) {
+		for i := range oldSlice {
+			diffValues(path+"["+strconv.Itoa(i)+"]", oldSlice[i], newSlice[i], lines)
+		}
+		return
+	}
+
+	*lines = append(*lines, fmt.Sprintf("%s: %s -> %s", path, formatValue(oldValue), formatValue(newValue)))
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
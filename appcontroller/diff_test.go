@@ -0,0 +1,97 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFieldDiff(t *testing.T) {
+	base := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test",
+			Namespace:       metav1.NamespaceDefault,
+			ResourceVersion: "1",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "test"},
+			Ports:    []corev1.ServicePort{{Port: 80}},
+		},
+	}
+
+	changed := base.DeepCopy()
+	changed.ResourceVersion = "2"
+	changed.Spec.Ports[0].Port = 8080
+	changed.Spec.Selector["tier"] = "web"
+	changed.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+
+	resized := base.DeepCopy()
+	resized.Spec.Ports = append(resized.Spec.Ports, corev1.ServicePort{Port: 443})
+
+	tests := []struct {
+		name     string
+		old, new runtime.Object
+		want     []string
+	}{
+		{
+			name: "unchanged",
+			old:  base,
+			new:  base.DeepCopy(),
+		},
+		{
+			name: "fields changed",
+			old:  base,
+			new:  changed,
+			want: []string{
+				`spec.ports[0].port: 80 -> 8080`,
+				`spec.selector.tier: <none> -> "web"`,
+			},
+		},
+		{
+			name: "list resized",
+			old:  base,
+			new:  resized,
+			want: []string{
+				`spec.ports: [{"port":80,"targetPort":0}] -> [{"port":80,"targetPort":0},{"port":443,"targetPort":0}]`,
+			},
+		},
+		{
+			name: "created",
+			old:  (*corev1.Service)(nil),
+			new:  &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+			want: []string{
+				`metadata.name: <none> -> "test"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fieldDiff(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got diff %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
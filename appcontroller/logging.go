@@ -0,0 +1,68 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/klog/v2"
+)
+
+// setupLogging configures the global klog logger for the given format. "text"
+// keeps the klog default, "json" writes one JSON object per line to stderr and
+// honours the -v flag. It must be called after flag.Parse.
+func setupLogging(format string) error {
+	switch format {
+	case "text":
+		return nil
+	case "json":
+		verbosity := 0
+		if f := flag.Lookup("v"); f != nil {
+			v, err := strconv.Atoi(f.Value.String())
+			if err != nil {
+				return fmt.Errorf("invalid -v value: %w", err)
+			}
+			verbosity = v
+		}
+		klog.SetLogger(funcr.NewJSON(func(obj string) {
+			fmt.Fprintln(os.Stderr, obj)
+		}, funcr.Options{
+			LogCaller:    funcr.All,
+			LogTimestamp: true,
+			Verbosity:    verbosity,
+		}))
+		return nil
+	default:
+		return fmt.Errorf("unsupported logging format %q", format)
+	}
+}
+
+// newReconcileID returns a random ID which ties together the log lines of a
+// single syncHandler run.
+func newReconcileID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
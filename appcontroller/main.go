@@ -18,7 +18,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"k8s.io/client-go/rest"
+	"os"
 	"time"
 
 	kubeinformers "k8s.io/client-go/informers"
@@ -34,35 +36,55 @@ import (
 )
 
 var (
-	masterURL  string
-	kubeconfig string
+	masterURL           string
+	kubeconfig          string
+	dryRun              bool
+	loggingFormat       string
+	shutdownGracePeriod time.Duration
 )
 
 func main() {
+	// "appcontroller render" prints the children of an App without a cluster.
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := runRender(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	klog.InitFlags(nil)
 	flag.Parse()
 
+	if err := setupLogging(loggingFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	logger := klog.Background()
+
 	// set up signals so we handle the first shutdown signal gracefully
-	stopCh := signals.SetupSignalHandler()
+	ctx := klog.NewContext(signals.SetupSignalHandler(), logger)
 
 	cfg, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
 	if err != nil {
 		clusterConfig, err := rest.InClusterConfig()
-		if err!= nil {
-			klog.Fatalf("Error building kubeconfig: %s", err.Error())
-
+		if err != nil {
+			logger.Error(err, "Error building kubeconfig")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 		}
 		cfg = clusterConfig
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		logger.Error(err, "Error building kubernetes clientset")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
 	appClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		klog.Fatalf("Error building example clientset: %s", err.Error())
+		logger.Error(err, "Error building app clientset")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
@@ -74,18 +96,30 @@ func main() {
 		appInformerFactory.Appcontroller().V1().Apps(),
 		kubeInformerFactory.Networking().V1().Ingresses(),
 	)
+	controller.dryRun = dryRun
+	controller.shutdownGracePeriod = shutdownGracePeriod
 
-	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(stopCh)
+	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(ctx.Done())
 	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
-	kubeInformerFactory.Start(stopCh)
-	appInformerFactory.Start(stopCh)
+	kubeInformerFactory.Start(ctx.Done())
+	appInformerFactory.Start(ctx.Done())
 
-	if err = controller.Run(2, stopCh); err != nil {
-		klog.Fatalf("Error running controller: %s", err.Error())
+	if err = controller.Run(ctx, 2); err != nil {
+		logger.Error(err, "Error running controller")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
+
+	// Wait for the informers to stop before exiting.
+	kubeInformerFactory.Shutdown()
+	appInformerFactory.Shutdown()
+	logger.Info("Shutdown complete")
+	klog.Flush()
 }
 
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&loggingFormat, "logging-format", "text", "Sets the log format. Permitted formats: text, json.")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", defaultShutdownGracePeriod, "How long in-flight reconciles may run after a shutdown signal before they are canceled.")
+	flag.BoolVar(&dryRun, "dry-run", false, "If true, send every create and update with server-side dry-run and report the diff in Events and logs instead of applying it.")
 }
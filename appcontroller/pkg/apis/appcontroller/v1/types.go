@@ -22,13 +22,18 @@ import (
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.deployment.replicas,statuspath=.status.replicas,selectorpath=.status.selector
 
 // App is a specification for a App resource
 type App struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   AppSpec   `json:"spec"`
+	Spec AppSpec `json:"spec"`
+	// Status is the observed state of the App's Deployment, filled in by
+	// the controller.
+	// +optional
 	Status AppStatus `json:"status"`
 }
 
@@ -43,6 +48,8 @@ type DeploymentSpec struct {
 	Name     string `json:"name"`
 	Image    string `json:"image"`
 	Replicas *int32 `json:"replicas"`
+	// Paused is propagated to the Deployment so a rollout can be held.
+	Paused bool `json:"paused,omitempty"`
 }
 
 type ServiceSpec struct {
@@ -57,6 +64,14 @@ type IngressSpec struct {
 // AppStatus is the status for a App resource
 type AppStatus struct {
 	AvailableReplicas int32 `json:"availableReplicas"`
+	// Replicas is the number of pods of the Deployment, for the scale
+	// subresource.
+	// +optional
+	Replicas int32 `json:"replicas"`
+	// Selector is the label selector of the pods of the Deployment in string
+	// form, for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,173 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	appv1 "github.com/2456868764/operator/appcontroller/pkg/apis/appcontroller/v1"
+)
+
+// childBuilders builds every object an App produces, in the order the
+// controller syncs them. A builder returns nil when the App does not request
+// that child, mirroring the checks in the sync functions. New child types must
+// be added here so that render stays in step with the controller.
+var childBuilders = []func(app *appv1.App) runtime.Object{
+	func(app *appv1.App) runtime.Object {
+		if app.Spec.Deployment.Name == "" {
+			return nil
+		}
+		return newDeployment(app)
+	},
+	func(app *appv1.App) runtime.Object {
+		if app.Spec.Service.Name == "" {
+			return nil
+		}
+		return newService(app)
+	},
+	func(app *appv1.App) runtime.Object {
+		if app.Spec.Ingress.Name == "" || app.Spec.Ingress.Hostname == "" {
+			return nil
+		}
+		return newIngress(app)
+	},
+}
+
+// runRender implements "appcontroller render". It reads App manifests and
+// prints the children the controller would create for them, without talking to
+// a cluster.
+func runRender(args []string, stdin io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	filename := fs.String("f", "", "File containing one or more App manifests, or - for stdin.")
+	output := fs.String("o", "yaml", "Output format. One of: yaml, json.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *filename == "" {
+		return fmt.Errorf("-f must be specified")
+	}
+	if *output != "yaml" && *output != "json" {
+		return fmt.Errorf("unsupported output format %q", *output)
+	}
+
+	in := stdin
+	if *filename != "-" {
+		f, err := os.Open(*filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	apps, err := decodeApps(in)
+	if err != nil {
+		return err
+	}
+	objs, err := renderChildren(apps)
+	if err != nil {
+		return err
+	}
+	return writeObjects(out, objs, *output)
+}
+
+// decodeApps reads a stream of YAML or JSON documents, each of which must be
+// an App.
+func decodeApps(in io.Reader) ([]*appv1.App, error) {
+	var apps []*appv1.App
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	for {
+		app := &appv1.App{}
+		if err := decoder.Decode(app); err != nil {
+			if err == io.EOF {
+				return apps, nil
+			}
+			return nil, err
+		}
+		// Skip empty documents, e.g. a leading "---".
+		if app.APIVersion == "" && app.Kind == "" {
+			continue
+		}
+		if gvk := app.GroupVersionKind(); gvk != appv1.SchemeGroupVersion.WithKind("App") {
+			return nil, fmt.Errorf("expected an App, got %s", gvk)
+		}
+		if app.Name == "" {
+			return nil, fmt.Errorf("App must have a name")
+		}
+		if app.Namespace == "" {
+			app.Namespace = metav1.NamespaceDefault
+		}
+		apps = append(apps, app)
+	}
+}
+
+// renderChildren runs every child builder against the apps and returns the
+// results with their apiVersion and kind set.
+func renderChildren(apps []*appv1.App) ([]runtime.Object, error) {
+	var objs []runtime.Object
+	for _, app := range apps {
+		for _, build := range childBuilders {
+			obj := build(app)
+			if obj == nil {
+				continue
+			}
+			gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+			if err != nil {
+				return nil, err
+			}
+			obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+// writeObjects prints objs as a multi-document YAML stream or as a stream of
+// JSON documents.
+func writeObjects(out io.Writer, objs []runtime.Object, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		for _, obj := range objs {
+			if err := encoder.Encode(obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
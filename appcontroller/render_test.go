@@ -0,0 +1,107 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const renderInput = `---
+apiVersion: appcontroller.jun.com/v1
+kind: App
+metadata:
+  name: first
+spec:
+  deployment:
+    name: first-deployment
+    image: nginx:latest
+    replicas: 2
+  service:
+    name: first-service
+  ingress:
+    name: first-ingress
+    hostname: first.example.com
+---
+apiVersion: appcontroller.jun.com/v1
+kind: App
+metadata:
+  name: second
+  namespace: apps
+spec:
+  deployment:
+    name: second-deployment
+    image: nginx:latest
+    replicas: 1
+  service:
+    name: second-service
+`
+
+type renderedObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+func TestRender(t *testing.T) {
+	want := []string{
+		"apps/v1 Deployment default/first-deployment",
+		"v1 Service default/first-service",
+		"networking.k8s.io/v1 Ingress default/first-ingress",
+		"apps/v1 Deployment apps/second-deployment",
+		"v1 Service apps/second-service",
+	}
+
+	for _, format := range []string{"yaml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if err := runRender([]string{"-f", "-", "-o", format}, strings.NewReader(renderInput), out); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			decoder := utilyaml.NewYAMLOrJSONDecoder(out, 4096)
+			for {
+				var obj renderedObject
+				if err := decoder.Decode(&obj); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("unexpected error decoding output: %v", err)
+				}
+				got = append(got, obj.APIVersion+" "+obj.Kind+" "+obj.Metadata.Namespace+"/"+obj.Metadata.Name)
+			}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("rendered objects mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRenderRejectsOtherKinds(t *testing.T) {
+	input := `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "test"}}`
+	err := runRender([]string{"-f", "-"}, strings.NewReader(input), io.Discard)
+	if err == nil {
+		t.Fatal("expected error rendering a ConfigMap, got nil")
+	}
+}
@@ -1,42 +1,324 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"github.com/2456868764/operator/client-go/pkg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"log"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
 )
 
-func main()  {
+func main() {
 	//conifg
 	//client
 	//informer
 	// add event handler
 	//informer.start
 
+	klog.InitFlags(nil)
+	output := flag.String("output", string(pkg.OutputIngress), "What to generate for annotated services: ingress, httproute or both.")
+	hostTemplate := flag.String("host-template", "", "Go template rendering the host of services without an ingress/host annotation, e.g. {{.Name}}.{{.Namespace}}.apps.example.com.")
+	gateway := flag.String("gateway", "", "Parent Gateway of generated HTTPRoutes, as name or namespace/name. Required unless --output=ingress.")
+	workers := flag.Int("workers", 5, "Number of services synced in parallel.")
+	maxRetries := flag.Int("max-retries", 10, "How often a failing service is retried before it is dropped from the queue.")
+	metricsAddr := flag.String("metrics-bind-address", ":8080", "Address serving /metrics and /healthz.")
+	leaderElect := flag.Bool("leader-elect", true, "Elect a leader with a Lease, so that only one replica syncs services.")
+	leaseNamespace := flag.String("leader-election-namespace", "ingress-manager", "Namespace of the leader election Lease.")
+	leaseName := flag.String("leader-election-id", "ingress-manager", "Name of the leader election Lease.")
+	includeNamespaces := flag.String("namespaces", "", "Comma separated namespaces to act in. Empty means all namespaces.")
+	excludeNamespaces := flag.String("exclude-namespaces", "kube-system", "Comma separated namespaces never to act in.")
+	namespaceSelector := flag.String("namespace-selector", "", "Label selector namespaces have to match, e.g. ingress-manager=enabled.")
+	defaultTemplate := flag.String("default-template", "", "ConfigMap, as namespace/name, holding the ingress template of services without an ingress/template annotation.")
+	serviceTemplates := flag.Bool("service-templates", false, "Let services render their ingress from a ConfigMap named by the ingress/template annotation.")
+	selfSignedTLS := flag.Bool("self-signed-tls", true, "Create self-signed certificates for ingress/tls services without an ingress/issuer annotation.")
+	flag.Parse()
+
+	// the first SIGINT or SIGTERM starts the graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
 	config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
 	if err != nil {
 		clusterConfig, err := rest.InClusterConfig()
-		if err!= nil {
-			log.Fatalln("can't get config")
-
+		if err != nil {
+			fatal(err, "Can't get config")
 		}
 		config = clusterConfig
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
-	if err!= nil {
-		log.Fatalln("can't create client")
+	if err != nil {
+		fatal(err, "Can't create client")
+	}
+
+	controllerConfig := pkg.Config{Workers: *workers, MaxRetries: *maxRetries}
+	controllerConfig.Namespaces = pkg.NamespaceFilter{
+		Include: splitList(*includeNamespaces),
+		Exclude: splitList(*excludeNamespaces),
+	}
+	controllerConfig.Namespaces.Selector, err = labels.Parse(*namespaceSelector)
+	if err != nil {
+		fatal(err, "Invalid --namespace-selector")
+	}
+	controllerConfig.Output, err = pkg.ParseOutput(*output)
+	if err != nil {
+		fatal(err, "Invalid --output")
+	}
+
+	if *hostTemplate != "" {
+		controllerConfig.HostTemplate, err = template.New("host").Option("missingkey=error").Parse(*hostTemplate)
+		if err != nil {
+			fatal(err, "Invalid --host-template")
+		}
+	}
+
+	var dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	if controllerConfig.Output != pkg.OutputIngress {
+		if *gateway == "" {
+			fatal(errors.New("--gateway is required for --output="+*output), "Invalid flags")
+		}
+		controllerConfig.Gateway = parseGateway(*gateway)
+		dynamicClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			fatal(err, "Can't create dynamic client")
+		}
+		dynamicFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0,
+			controllerConfig.Namespaces.InformerNamespace(), controllerConfig.Namespaces.TweakListOptions)
+		controllerConfig.DynamicClient = dynamicClient
+		controllerConfig.RouteInformer = dynamicFactory.ForResource(pkg.HTTPRouteGVR)
 	}
 
-	factory := informers.NewSharedInformerFactory(clientset, 0)
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, controllerConfig.Namespaces.InformerOptions()...)
+	// namespaces are cluster scoped, they can not come from the filtered factory
+	namespaceFactory := informers.NewSharedInformerFactory(clientset, 0)
+	controllerConfig.NamespaceInformer = namespaceFactory.Core().V1().Namespaces()
+	// ConfigMaps are only watched when services may pick their template
+	if *serviceTemplates {
+		controllerConfig.ConfigMapInformer = factory.Core().V1().ConfigMaps()
+	}
+	// the default template may live outside the watched namespaces, only
+	// that one ConfigMap is watched
+	var templateFactory informers.SharedInformerFactory
+	if *defaultTemplate != "" {
+		namespace, name, ok := strings.Cut(*defaultTemplate, "/")
+		if !ok || namespace == "" || name == "" {
+			fatal(errors.New("expected namespace/name, got "+*defaultTemplate), "Invalid --default-template")
+		}
+		templateFactory = informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = "metadata.name=" + name
+			}))
+		controllerConfig.DefaultTemplate = types.NamespacedName{Namespace: namespace, Name: name}
+		controllerConfig.DefaultTemplateInformer = templateFactory.Core().V1().ConfigMaps()
+	}
+	// only the certificate secrets created by the controller are watched,
+	// not every secret of the watched namespaces
+	var secretFactory informers.SharedInformerFactory
+	if *selfSignedTLS && controllerConfig.Output != pkg.OutputHTTPRoute {
+		secretFactory = informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+			informers.WithNamespace(controllerConfig.Namespaces.InformerNamespace()),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				controllerConfig.Namespaces.TweakListOptions(options)
+				options.LabelSelector = pkg.CertificateSecretSelector
+			}))
+		controllerConfig.SecretInformer = secretFactory.Core().V1().Secrets()
+	}
 	serviceInformer := factory.Core().V1().Services()
 	ingressInformer := factory.Networking().V1().Ingresses()
-	controller := pkg.NewController(clientset, serviceInformer, ingressInformer)
-	stopCh := make(chan struct{})
-	factory.Start(stopCh)
-	factory.WaitForCacheSync(stopCh)
-	controller.Run(stopCh)
+	controller := pkg.NewController(clientset, serviceInformer, ingressInformer, controllerConfig)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if err := controller.RegisterMetrics(registry); err != nil {
+		fatal(err, "Can't register metrics")
+	}
+	// fails the health check if the leader does not renew its lease in time
+	electionChecker := leaderelection.NewLeaderHealthzAdaptor(20 * time.Second)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := electionChecker.Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	server := &http.Server{Addr: *metricsAddr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err, "Can't serve metrics")
+		}
+	}()
+
+	run := func(ctx context.Context) {
+		factory.Start(ctx.Done())
+		namespaceFactory.Start(ctx.Done())
+		factory.WaitForCacheSync(ctx.Done())
+		namespaceFactory.WaitForCacheSync(ctx.Done())
+		if secretFactory != nil {
+			secretFactory.Start(ctx.Done())
+			secretFactory.WaitForCacheSync(ctx.Done())
+		}
+		if templateFactory != nil {
+			templateFactory.Start(ctx.Done())
+			templateFactory.WaitForCacheSync(ctx.Done())
+		}
+		if dynamicFactory != nil {
+			dynamicFactory.Start(ctx.Done())
+			if !cache.WaitForCacheSync(ctx.Done(), controllerConfig.RouteInformer.Informer().HasSynced) {
+				klog.ErrorS(nil, "Can't sync httproutes, is the Gateway API installed?")
+				return
+			}
+		}
+		controller.Run(ctx)
+	}
+
+	if *leaderElect {
+		hostname, err := os.Hostname()
+		if err != nil {
+			fatal(err, "Can't get hostname")
+		}
+		lock := &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{Namespace: *leaseNamespace, Name: *leaseName},
+			Client:    clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: hostname + "_" + string(uuid.NewUUID()),
+			},
+		}
+		runLeaderElection(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			WatchDog:        electionChecker,
+			Name:            *leaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStoppedLeading: func() {
+					if ctx.Err() == nil {
+						// another replica may already be syncing, stop right away
+						fatal(errors.New("leader election lost"), "Stopping")
+					}
+				},
+			},
+		}, run)
+	} else {
+		run(ctx)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		klog.ErrorS(err, "Can't stop metrics server")
+	}
+	klog.InfoS("Shutdown complete")
+	klog.Flush()
+}
+
+// runLeaderElection calls run once the lease is acquired and returns when ctx
+// is done. The lease is kept until run returned, so that the workers drain
+// before another replica can take over. Losing the lease cancels run too.
+func runLeaderElection(ctx context.Context, config leaderelection.LeaderElectionConfig, run func(ctx context.Context)) {
+	// the election outlives ctx until run drained, cancelling it releases
+	// the lease
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+	defer cancelElection()
+
+	var mu sync.Mutex
+	leading, stopping := false, false
+	done := make(chan struct{})
+	config.Callbacks.OnStartedLeading = func(leaderCtx context.Context) {
+		mu.Lock()
+		if stopping {
+			mu.Unlock()
+			return
+		}
+		leading = true
+		mu.Unlock()
+		defer close(done)
+		defer cancelElection()
+
+		runCtx, cancel := context.WithCancel(leaderCtx)
+		defer cancel()
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-runCtx.Done():
+			}
+		}()
+		run(runCtx)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-electionCtx.Done():
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		stopping = true
+		if !leading {
+			// nothing to drain, stop acquiring
+			cancelElection()
+		}
+	}()
+
+	leaderelection.RunOrDie(electionCtx, config)
+	mu.Lock()
+	wasLeading := leading
+	mu.Unlock()
+	if wasLeading {
+		<-done
+	}
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func fatal(err error, msg string) {
+	klog.ErrorS(err, msg)
+	klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+}
+
+// parseGateway splits a namespace/name reference, a bare name leaves the
+// namespace empty.
+func parseGateway(value string) types.NamespacedName {
+	if namespace, name, ok := strings.Cut(value, "/"); ok {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	return types.NamespacedName{Name: value}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestLeaderElectionWaitsForDrain(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: "ingress-manager", Name: "ingress-manager"},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: "test"},
+	}
+	holder := func() string {
+		lease, err := client.CoordinationV1().Leases("ingress-manager").Get(context.Background(), "ingress-manager", metav1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	drain := make(chan struct{})
+	// set by run once it drained, and the holder of the lease by then
+	drained := false
+	holderWhileDraining := ""
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		runLeaderElection(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks:       leaderelection.LeaderCallbacks{OnStoppedLeading: func() {}},
+		}, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			// the workers are still draining
+			<-drain
+			holderWhileDraining = holder()
+			drained = true
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("run was not called")
+	}
+	cancel()
+	select {
+	case <-returned:
+		t.Fatal("returned before the workers drained")
+	default:
+	}
+	close(drain)
+	select {
+	case <-returned:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("did not return after the workers drained")
+	}
+
+	if !drained {
+		t.Error("returned before run returned")
+	}
+	if holderWhileDraining != "test" {
+		t.Errorf("lease held by %q while draining, want test", holderWhileDraining)
+	}
+	if got := holder(); got != "" {
+		t.Errorf("lease held by %q after shutdown, want released", got)
+	}
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"fmt"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+)
+
+// Annotations published on a service once its ingress got an address from
+// the ingress controller.
+const (
+	annotationAddress = "ingress/address"
+	annotationURL     = "ingress/url"
+)
+
+const (
+	// ReasonIngressReady is the reason of the event recorded on a service
+	// when its ingress becomes reachable.
+	ReasonIngressReady = "IngressReady"
+)
+
+// ingressAddress returns the first load-balancer IP or hostname of ingress,
+// or "" while the ingress controller has not assigned one.
+func ingressAddress(ingress *v15.Ingress) string {
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			return lb.IP
+		}
+		if lb.Hostname != "" {
+			return lb.Hostname
+		}
+	}
+	return ""
+}
+
+// ingressURL returns the URL the service is reachable at. Without a host the
+// rule matches every host, so the address is used instead.
+func ingressURL(opts ingressOptions, address string) string {
+	scheme := "http"
+	if opts.tls {
+		scheme = "https"
+	}
+	host := opts.host
+	if host == "" {
+		host = address
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, opts.path)
+}
+
+// syncAddress publishes the address of ingress on service, or clears it if
+// ingress is nil or has no address yet. The event is only recorded when the
+// address changes.
+func (c *controller) syncAddress(service *v17.Service, ingress *v15.Ingress, opts ingressOptions) error {
+	address := ""
+	if ingress != nil {
+		address = ingressAddress(ingress)
+	}
+	if address == "" {
+		return c.clearAddress(service)
+	}
+
+	url := ingressURL(opts, address)
+	if service.Annotations[annotationAddress] == address && service.Annotations[annotationURL] == url {
+		return nil
+	}
+	if err := c.patchServiceAnnotations(service, map[string]*string{annotationAddress: &address, annotationURL: &url}); err != nil {
+		return err
+	}
+	c.recorder.Eventf(service, v17.EventTypeNormal, ReasonIngressReady, "Reachable at %s (address %s)", url, address)
+	return nil
+}
+
+// clearAddress removes the published address from service.
+func (c *controller) clearAddress(service *v17.Service) error {
+	_, hasAddress := service.Annotations[annotationAddress]
+	_, hasURL := service.Annotations[annotationURL]
+	if !hasAddress && !hasURL {
+		return nil
+	}
+	return c.patchServiceAnnotations(service, map[string]*string{annotationAddress: nil, annotationURL: nil})
+}
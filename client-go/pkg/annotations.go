@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Annotations read from a Service. Only annotationHTTP is required, the
+// others tune the generated ingress.
+const (
+	annotationHTTP     = "ingress/http"
+	annotationHost     = "ingress/host"
+	annotationPath     = "ingress/path"
+	annotationPort     = "ingress/port"
+	annotationClass    = "ingress/class"
+	annotationPathType = "ingress/path-type"
+
+	annotationTLS              = "ingress/tls"
+	annotationTLSIssuer        = "ingress/tls-issuer"
+	annotationTLSClusterIssuer = "ingress/tls-cluster-issuer"
+)
+
+// cert-manager annotations set on the ingress when an issuer is configured.
+const (
+	certManagerIssuer        = "cert-manager.io/issuer"
+	certManagerClusterIssuer = "cert-manager.io/cluster-issuer"
+)
+
+// managedIngressAnnotations are the ingress annotations owned by the
+// controller, anything else on the ingress is left alone.
+var managedIngressAnnotations = []string{certManagerIssuer, certManagerClusterIssuer}
+
+const (
+	defaultPath     = "/"
+	defaultPathType = v15.PathTypePrefix
+)
+
+// ingressOptions is the validated form of the ingress annotations of a service.
+type ingressOptions struct {
+	host      string
+	path      string
+	pathType  v15.PathType
+	port      v15.ServiceBackendPort
+	className *string
+
+	// tls enables TLS for host using the secret tlsSecretName.
+	tls           bool
+	tlsSecretName string
+	// ingressAnnotations are passed through to the ingress, they name the
+	// cert-manager issuer of the certificate.
+	ingressAnnotations map[string]string
+}
+
+// selfSigned reports whether the controller has to provide the certificate,
+// because TLS is enabled without an issuer.
+func (o ingressOptions) selfSigned() bool {
+	return o.tls && len(o.ingressAnnotations) == 0
+}
+
+// tlsSecretName returns the name of the certificate secret for a service.
+func tlsSecretName(service *v17.Service) string {
+	return service.Name + "-tls"
+}
+
+// parseAnnotations validates the ingress annotations of service and fills in
+// defaults for the missing ones. Without a host annotation the host is
+// rendered from hostTemplate, if there is one. All problems are reported in
+// one error.
+func parseAnnotations(service *v17.Service, hostTemplate *template.Template) (ingressOptions, error) {
+	annotations := service.GetAnnotations()
+	opts := ingressOptions{
+		host:     annotations[annotationHost],
+		path:     defaultPath,
+		pathType: defaultPathType,
+	}
+	var errs []string
+
+	if opts.host != "" {
+		if msgs := validateHost(opts.host); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", annotationHost, opts.host, strings.Join(msgs, ", ")))
+		}
+	} else if hostTemplate != nil {
+		host, err := renderHost(hostTemplate, service)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("host template: %v", err))
+		} else if msgs := validateHost(host); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("host template rendered %q: %s", host, strings.Join(msgs, ", ")))
+		}
+		opts.host = host
+	}
+
+	if path, ok := annotations[annotationPath]; ok {
+		if !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Sprintf("%s %q: must start with /", annotationPath, path))
+		}
+		opts.path = path
+	}
+
+	if pathType, ok := annotations[annotationPathType]; ok {
+		switch v15.PathType(pathType) {
+		case v15.PathTypeExact, v15.PathTypePrefix, v15.PathTypeImplementationSpecific:
+			opts.pathType = v15.PathType(pathType)
+		default:
+			errs = append(errs, fmt.Sprintf("%s %q: must be one of Exact, Prefix, ImplementationSpecific", annotationPathType, pathType))
+		}
+	}
+
+	if class, ok := annotations[annotationClass]; ok {
+		if msgs := validation.IsDNS1123Subdomain(class); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", annotationClass, class, strings.Join(msgs, ", ")))
+		}
+		opts.className = &class
+	}
+
+	if name, ok := annotations[annotationTemplate]; ok {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", annotationTemplate, name, strings.Join(msgs, ", ")))
+		}
+	}
+
+	if value, ok := annotations[annotationTLS]; ok {
+		tls, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q: must be true or false", annotationTLS, value))
+		}
+		opts.tls = tls
+		opts.tlsSecretName = tlsSecretName(service)
+	}
+
+	issuer, hasIssuer := annotations[annotationTLSIssuer]
+	clusterIssuer, hasClusterIssuer := annotations[annotationTLSClusterIssuer]
+	switch {
+	case hasIssuer && hasClusterIssuer:
+		errs = append(errs, fmt.Sprintf("only one of %s and %s may be set", annotationTLSIssuer, annotationTLSClusterIssuer))
+	case hasIssuer:
+		if msgs := validation.IsDNS1123Subdomain(issuer); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", annotationTLSIssuer, issuer, strings.Join(msgs, ", ")))
+		}
+		opts.ingressAnnotations = map[string]string{certManagerIssuer: issuer}
+	case hasClusterIssuer:
+		if msgs := validation.IsDNS1123Subdomain(clusterIssuer); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: %s", annotationTLSClusterIssuer, clusterIssuer, strings.Join(msgs, ", ")))
+		}
+		opts.ingressAnnotations = map[string]string{certManagerClusterIssuer: clusterIssuer}
+	}
+	if !opts.tls {
+		// an issuer alone does not enable TLS
+		opts.ingressAnnotations = nil
+	}
+
+	port, err := backendPort(service, annotations[annotationPort])
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	opts.port = port
+
+	if len(errs) > 0 {
+		return ingressOptions{}, fmt.Errorf("invalid annotations: %s", strings.Join(errs, "; "))
+	}
+	return opts, nil
+}
+
+// renderHost executes the host template against the service, so that e.g.
+// {{.Name}} and {{.Namespace}} refer to the service.
+func renderHost(hostTemplate *template.Template, service *v17.Service) (string, error) {
+	var buf bytes.Buffer
+	if err := hostTemplate.Execute(&buf, service); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func validateHost(host string) []string {
+	if strings.HasPrefix(host, "*.") {
+		return validation.IsWildcardDNS1123Subdomain(host)
+	}
+	return validation.IsDNS1123Subdomain(host)
+}
+
+// backendPort resolves the port annotation, a port number or name, against
+// the ports of service. Without the annotation the first port is used.
+func backendPort(service *v17.Service, value string) (v15.ServiceBackendPort, error) {
+	ports := service.Spec.Ports
+	if value == "" {
+		if len(ports) == 0 {
+			return v15.ServiceBackendPort{}, fmt.Errorf("service has no ports and %s is not set", annotationPort)
+		}
+		if ports[0].Name != "" {
+			return v15.ServiceBackendPort{Name: ports[0].Name}, nil
+		}
+		return v15.ServiceBackendPort{Number: ports[0].Port}, nil
+	}
+
+	if number, err := strconv.Atoi(value); err == nil {
+		for _, p := range ports {
+			if int(p.Port) == number {
+				return v15.ServiceBackendPort{Number: p.Port}, nil
+			}
+		}
+		return v15.ServiceBackendPort{}, fmt.Errorf("%s %q: service has no such port", annotationPort, value)
+	}
+	for _, p := range ports {
+		if p.Name == value {
+			return v15.ServiceBackendPort{Name: p.Name}, nil
+		}
+	}
+	return v15.ServiceBackendPort{}, fmt.Errorf("%s %q: service has no such port", annotationPort, value)
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+
+	v15 "k8s.io/api/networking/v1"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	nginx := "nginx"
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        ingressOptions
+		wantErr     bool
+	}{
+		{
+			name:        "defaults",
+			annotations: map[string]string{annotationHTTP: "true"},
+			want:        ingressOptions{path: "/", pathType: v15.PathTypePrefix, port: v15.ServiceBackendPort{Name: "http"}},
+		},
+		{
+			name: "all set",
+			annotations: map[string]string{
+				annotationHTTP:     "true",
+				annotationHost:     "*.example.com",
+				annotationPath:     "/api",
+				annotationPathType: "Exact",
+				annotationPort:     "8080",
+				annotationClass:    "nginx",
+			},
+			want: ingressOptions{
+				host:      "*.example.com",
+				path:      "/api",
+				pathType:  v15.PathTypeExact,
+				port:      v15.ServiceBackendPort{Number: 8080},
+				className: &nginx,
+			},
+		},
+		{
+			name:        "tls with issuer",
+			annotations: map[string]string{annotationHost: "example.com", annotationTLS: "true", annotationTLSClusterIssuer: "letsencrypt"},
+			want: ingressOptions{
+				host:               "example.com",
+				path:               "/",
+				pathType:           v15.PathTypePrefix,
+				port:               v15.ServiceBackendPort{Name: "http"},
+				tls:                true,
+				tlsSecretName:      "test-tls",
+				ingressAnnotations: map[string]string{certManagerClusterIssuer: "letsencrypt"},
+			},
+		},
+		{name: "invalid host", annotations: map[string]string{annotationHost: "Not A Host"}, wantErr: true},
+		{name: "relative path", annotations: map[string]string{annotationPath: "api"}, wantErr: true},
+		{name: "invalid path type", annotations: map[string]string{annotationPathType: "Regex"}, wantErr: true},
+		{name: "unknown port", annotations: map[string]string{annotationPort: "grpc"}, wantErr: true},
+		{
+			// the host may still come from an ingress template
+			name:        "tls without host",
+			annotations: map[string]string{annotationTLS: "true"},
+			want: ingressOptions{
+				path:          "/",
+				pathType:      v15.PathTypePrefix,
+				port:          v15.ServiceBackendPort{Name: "http"},
+				tls:           true,
+				tlsSecretName: "test-tls",
+			},
+		},
+		{name: "two issuers", annotations: map[string]string{annotationHost: "example.com", annotationTLS: "true", annotationTLSIssuer: "a", annotationTLSClusterIssuer: "b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAnnotations(newService("test", tt.annotations), nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAnnotationsHostTemplate(t *testing.T) {
+	hostTemplate := template.Must(template.New("host").Parse("{{.Name}}.{{.Namespace}}.apps.example.com"))
+	tests := []struct {
+		name        string
+		service     string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "rendered", service: "web", want: "web.default.apps.example.com"},
+		{name: "annotation wins", service: "web", annotations: map[string]string{annotationHost: "web.example.com"}, want: "web.example.com"},
+		{name: "invalid result", service: "Web_1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAnnotations(newService(tt.service, tt.annotations), hostTemplate)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got host %q", got.host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.host != tt.want {
+				t.Errorf("got host %q, want %q", got.host, tt.want)
+			}
+		})
+	}
+}
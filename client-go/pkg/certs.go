@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	v17 "k8s.io/api/core/v1"
+)
+
+// The self-signed certificate secrets carry the managedByLabel, so that only
+// they are listed and watched, see CertificateSecretSelector.
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "ingress-manager"
+)
+
+// CertificateSecretSelector selects the self-signed certificate secrets
+// created by the controller. Config.SecretInformer has to be limited to it.
+const CertificateSecretSelector = managedByLabel + "=" + managedByValue
+
+const (
+	// certValidity is the lifetime of a self-signed certificate.
+	certValidity = 90 * 24 * time.Hour
+	// certRenewBefore is how long before expiry a certificate is replaced.
+	certRenewBefore = 30 * 24 * time.Hour
+)
+
+// generateSelfSignedCert returns a PEM encoded certificate and key for host,
+// valid from now for certValidity.
+func generateSelfSignedCert(host string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host, Organization: []string{"ingress-manager"}},
+		DNSNames:              []string{host},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// certRenewalTime returns when the certificate in secret has to be replaced.
+// It is the zero time if the secret holds no certificate for host.
+func certRenewalTime(secret *v17.Secret, host string) (time.Time, error) {
+	block, _ := pem.Decode(secret.Data[v17.TLSCertKey])
+	if block == nil {
+		return time.Time{}, errors.New("no certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != host {
+		return time.Time{}, nil
+	}
+	return cert.NotAfter.Add(-certRenewBefore), nil
+}
@@ -0,0 +1,273 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// hostPathIndex indexes ingresses by the hosts and paths they route.
+const hostPathIndex = "hostPath"
+
+// annotationConflict is set on a service which lost a host and path to
+// another service or ingress, it explains who holds them.
+const annotationConflict = "ingress/conflict"
+
+// hostPathKey joins host and path, paths start with a slash so the result is
+// unambiguous.
+func hostPathKey(host, path string) string {
+	return host + path
+}
+
+// hostPaths tracks the host and path every annotated service asks for, the
+// way syncService resolves them. A template may choose another host than the
+// annotations, and templates live in ConfigMaps, so this can not be an index
+// of the service informer.
+type hostPaths struct {
+	mu sync.Mutex
+	// byService maps service keys to host path keys, byHostPath the other
+	// way round
+	byService  map[string]string
+	byHostPath map[string]map[string]bool
+}
+
+func newHostPaths() *hostPaths {
+	return &hostPaths{byService: map[string]string{}, byHostPath: map[string]map[string]bool{}}
+}
+
+// set records that service asks for hostPath, an empty hostPath forgets the
+// service. It returns what service asked for before.
+func (h *hostPaths) set(service, hostPath string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.byService[service]
+	if old == hostPath {
+		return old
+	}
+	if old != "" {
+		delete(h.byHostPath[old], service)
+		if len(h.byHostPath[old]) == 0 {
+			delete(h.byHostPath, old)
+		}
+		delete(h.byService, service)
+	}
+	if hostPath != "" {
+		h.byService[service] = hostPath
+		if h.byHostPath[hostPath] == nil {
+			h.byHostPath[hostPath] = map[string]bool{}
+		}
+		h.byHostPath[hostPath][service] = true
+	}
+	return old
+}
+
+// services returns the keys of the services asking for hostPath.
+func (h *hostPaths) services(hostPath string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.byHostPath[hostPath]))
+	for key := range h.byHostPath[hostPath] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// serviceHostPath returns the host path key service asks for, or "" if it
+// gets no ingress. It follows syncService without recording events.
+func (c *controller) serviceHostPath(service *v17.Service) string {
+	if _, ok := service.Annotations[annotationHTTP]; !ok {
+		return ""
+	}
+	opts, err := parseAnnotations(service, c.hostTemplate)
+	if err != nil {
+		return ""
+	}
+	if c.output.ingress() {
+		configMap, err := c.templateFor(service)
+		if err != nil {
+			return ""
+		}
+		if configMap != nil {
+			ingress, err := renderIngress(configMap, service, opts)
+			if err != nil {
+				return ""
+			}
+			opts.host, opts.path = renderedHostPath(ingress, opts)
+		}
+	}
+	return hostPathKey(opts.host, opts.path)
+}
+
+// loadHostPaths records the host and path of every service, so that the
+// first syncs already see all competitors. The caches have to be synced.
+func (c *controller) loadHostPaths() {
+	services, err := c.serviceLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, service := range services {
+		if key, err := cache.MetaNamespaceKeyFunc(service); err == nil {
+			c.hostPaths.set(key, c.serviceHostPath(service))
+		}
+	}
+}
+
+// setHostPath records the host path key of the service key and requeues the
+// services competing for the one it asked for before, which may have been
+// released.
+func (c *controller) setHostPath(key, hostPath string) {
+	old := c.hostPaths.set(key, hostPath)
+	if old == "" || old == hostPath {
+		return
+	}
+	for _, peer := range c.hostPaths.services(old) {
+		c.queue.Add(peer)
+	}
+}
+
+// ingressHostPathIndexFunc indexes ingresses by every host and path they route.
+func ingressHostPathIndexFunc(obj interface{}) ([]string, error) {
+	ingress, ok := obj.(*v15.Ingress)
+	if !ok {
+		return nil, nil
+	}
+	var keys []string
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			keys = append(keys, hostPathKey(rule.Host, path.Path))
+		}
+	}
+	return keys, nil
+}
+
+// olderService orders services by creation time, then by namespace and name,
+// so that every sync picks the same winner.
+func olderService(a, b *v17.Service) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// resolveHostPath decides whether service may use the host and path of opts.
+// It returns who holds them instead, or the keys of the services which lost
+// them to service. An ingress not generated for one of the competing services
+// always wins, among the services the oldest one wins.
+func (c *controller) resolveHostPath(service *v17.Service, opts ingressOptions) (string, []string, error) {
+	key := hostPathKey(opts.host, opts.path)
+	var others []*v17.Service
+	for _, serviceKey := range c.hostPaths.services(key) {
+		namespace, name, err := cache.SplitMetaNamespaceKey(serviceKey)
+		if err != nil {
+			continue
+		}
+		other, err := c.serviceLister.Services(namespace).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if other.UID != service.UID && c.namespaceAllowed(other.Namespace) {
+			others = append(others, other)
+		}
+	}
+	winner := service
+	candidates := map[types.UID]bool{service.UID: true}
+	for _, other := range others {
+		candidates[other.UID] = true
+		if olderService(other, winner) {
+			winner = other
+		}
+	}
+
+	ingressObjs, err := c.ingressIndexer.ByIndex(hostPathIndex, key)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, obj := range ingressObjs {
+		ingress := obj.(*v15.Ingress)
+		ownerReference := v16.GetControllerOf(ingress)
+		if ownerReference != nil && ownerReference.Kind == "Service" && candidates[ownerReference.UID] {
+			continue
+		}
+		return fmt.Sprintf("ingress %s/%s", ingress.Namespace, ingress.Name), nil, nil
+	}
+
+	if winner != service {
+		return fmt.Sprintf("service %s/%s", winner.Namespace, winner.Name), nil, nil
+	}
+	// only losers which do not know about service yet need a sync
+	message := conflictMessage(opts, fmt.Sprintf("service %s/%s", service.Namespace, service.Name))
+	var losers []string
+	for _, other := range others {
+		if other.Annotations[annotationConflict] != message {
+			losers = append(losers, other.Namespace+"/"+other.Name)
+		}
+	}
+	return "", losers, nil
+}
+
+// reportConflict marks service as having lost its host and path to holder and
+// removes what was generated for it. The event is only recorded when the
+// conflict is new.
+func (c *controller) reportConflict(service *v17.Service, opts ingressOptions, holder string) error {
+	message := conflictMessage(opts, holder)
+	if service.Annotations[annotationConflict] != message {
+		c.recorder.Event(service, v17.EventTypeWarning, ReasonHostConflict, message)
+		if err := c.patchServiceAnnotations(service, map[string]*string{annotationConflict: &message}); err != nil {
+			return err
+		}
+	}
+	if c.output.httpRoute() {
+		if err := c.deleteHTTPRoute(service.Namespace, service.Name); err != nil {
+			return err
+		}
+	}
+	return c.deleteServiceIngress(service)
+}
+
+func conflictMessage(opts ingressOptions, holder string) string {
+	return fmt.Sprintf("host %q and path %q are used by %s", opts.host, opts.path, holder)
+}
+
+// clearConflict removes the conflict annotation once service is no longer in
+// conflict.
+func (c *controller) clearConflict(service *v17.Service) error {
+	if _, ok := service.Annotations[annotationConflict]; !ok {
+		return nil
+	}
+	return c.patchServiceAnnotations(service, map[string]*string{annotationConflict: nil})
+}
+
+// patchServiceAnnotations sets the given annotations of service with a merge
+// patch, a nil value removes the annotation.
+func (c *controller) patchServiceAnnotations(service *v17.Service, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().Services(service.Namespace).Patch(context.TODO(), service.Name, types.MergePatchType, patch, v16.PatchOptions{})
+	return err
+}
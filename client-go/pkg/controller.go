@@ -2,34 +2,126 @@ package pkg
 
 import (
 	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	v17 "k8s.io/api/core/v1"
 	v15 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	v13 "k8s.io/client-go/informers/core/v1"
 	v14 "k8s.io/client-go/informers/networking/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	v12 "k8s.io/client-go/listers/core/v1"
 	v1 "k8s.io/client-go/listers/networking/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	"reflect"
+	"k8s.io/klog/v2"
+	"sync"
+	"text/template"
 	"time"
 )
 
+// defaults for Config.Workers and Config.MaxRetries
 const (
-	workNum = 5
+	workNum  = 5
 	maxRetry = 10
 )
 
+const (
+	// ReasonInvalidAnnotation is the reason of the event recorded on a
+	// service whose ingress annotations can not be used.
+	ReasonInvalidAnnotation = "InvalidAnnotation"
+	// ReasonHostConflict is the reason of the event recorded on a service
+	// whose host and path are already used by another ingress.
+	ReasonHostConflict = "HostConflict"
+	// ReasonSecretExists is the reason of the event recorded on a service
+	// whose certificate secret was created by someone else.
+	ReasonSecretExists = "SecretExists"
+)
+
 type controller struct {
 	client        kubernetes.Interface
 	ingressLister v1.IngressLister
-	serviceLister v12.ServiceLister
-	queue         workqueue.RateLimitingInterface
+	// the indexers hold the same objects as the listers, services indexed by
+	// templateIndex and ingresses by hostPathIndex
+	serviceIndexer cache.Indexer
+	ingressIndexer cache.Indexer
+	serviceLister  v12.ServiceLister
+	// secretLister is nil when self-signed certificates are disabled
+	secretLister v12.SecretLister
+	// foreignSecrets holds the keys of the services whose certificate secret
+	// was created by someone else, the secret lister does not see those
+	foreignSecrets *sync.Map
+	queue          workqueue.RateLimitingInterface
+	recorder       record.EventRecorder
+
+	output        Output
+	dynamicClient dynamic.Interface
+	routeLister   cache.GenericLister
+	gateway       types.NamespacedName
+	hostTemplate  *template.Template
+
+	workers    int
+	maxRetries int
+	// namespaces selects the namespaces to act in, namespaceLister is only
+	// set when it has a label selector
+	namespaces      NamespaceFilter
+	namespaceLister v12.NamespaceLister
+	// configMapLister is nil when the ingress/template annotation is disabled
+	configMapLister       v12.ConfigMapLister
+	defaultTemplate       types.NamespacedName
+	defaultTemplateLister v12.ConfigMapLister
+	syncErrors            prometheus.Counter
+	// hostPaths holds what the services asked for when they were last synced
+	hostPaths *hostPaths
+}
+
+// Config holds the settings of the controller which are not informers.
+type Config struct {
+	// Output selects whether Ingresses, HTTPRoutes or both are generated.
+	// Empty means OutputIngress.
+	Output Output
+	// DynamicClient, RouteInformer and Gateway are only used when Output
+	// includes HTTPRoutes. Gateway is the parent every HTTPRoute is attached
+	// to, its namespace defaults to the namespace of the route.
+	DynamicClient dynamic.Interface
+	RouteInformer informers.GenericInformer
+	Gateway       types.NamespacedName
+	// HostTemplate renders the host of services without an ingress/host
+	// annotation, with the service as data. Nil leaves the host empty.
+	HostTemplate *template.Template
+	// Workers is the number of services synced in parallel, MaxRetries how
+	// often a failing service is retried before it is dropped. Zero means the
+	// default.
+	Workers    int
+	MaxRetries int
+	// Namespaces selects the namespaces services are synced in. With a label
+	// selector NamespaceInformer is required to look up namespace labels.
+	Namespaces        NamespaceFilter
+	NamespaceInformer v13.NamespaceInformer
+	// ConfigMapInformer enables the ingress/template annotation, it has to
+	// cover the namespaces of the services. Without it the annotation is
+	// ignored. DefaultTemplate names the ConfigMap used by services without
+	// a template of their own, it is looked up with DefaultTemplateInformer.
+	// Without it such services get the built-in ingress.
+	ConfigMapInformer       v13.ConfigMapInformer
+	DefaultTemplate         types.NamespacedName
+	DefaultTemplateInformer v13.ConfigMapInformer
+	// SecretInformer enables self-signed certificates for services with TLS
+	// but without an issuer. It only has to cover the secrets matching
+	// CertificateSecretSelector. Without it such services use a
+	// <service>-tls secret provided by someone else.
+	SecretInformer v13.SecretInformer
 }
 
 func (c *controller) addService(obj interface{}) {
@@ -37,44 +129,145 @@ func (c *controller) addService(obj interface{}) {
 
 }
 func (c *controller) updateService(oldObj interface{}, newObj interface{}) {
-	//todo compare with annotation
-	if reflect.DeepEqual(oldObj, newObj) {
+	oldService := oldObj.(*v17.Service)
+	newService := newObj.(*v17.Service)
+	// the generated ingress only depends on the annotations and the ports
+	if equality.Semantic.DeepEqual(oldService.Annotations, newService.Annotations) &&
+		equality.Semantic.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) {
 		return
 	}
 	c.enqueue(newObj)
 }
 
+func (c *controller) deleteService(obj interface{}) {
+	// DeletionHandlingMetaNamespaceKeyFunc takes care of tombstones
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *controller) updateIngress(oldObj interface{}, newObj interface{}) {
+	oldIngress := oldObj.(*v15.Ingress)
+	newIngress := newObj.(*v15.Ingress)
+	if oldIngress.ResourceVersion == newIngress.ResourceVersion {
+		return
+	}
+	c.enqueueOwner(newIngress)
+}
+
 func (c *controller) deleteIngress(obj interface{}) {
-	ingress := obj.(*v15.Ingress)
-	ownerReference := v16.GetControllerOf(ingress)
+	ingress, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+	c.enqueueOwner(ingress)
+}
+
+func (c *controller) updateRoute(oldObj interface{}, newObj interface{}) {
+	oldRoute := oldObj.(v16.Object)
+	newRoute := newObj.(v16.Object)
+	if oldRoute.GetResourceVersion() == newRoute.GetResourceVersion() {
+		return
+	}
+	c.enqueueOwner(newRoute)
+}
+
+func (c *controller) deleteRoute(obj interface{}) {
+	route, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+	c.enqueueOwner(route)
+}
+
+func (c *controller) updateSecret(oldObj interface{}, newObj interface{}) {
+	oldSecret := oldObj.(*v17.Secret)
+	newSecret := newObj.(*v17.Secret)
+	if oldSecret.ResourceVersion == newSecret.ResourceVersion {
+		return
+	}
+	c.enqueueOwner(newSecret)
+}
+
+func (c *controller) deleteSecret(obj interface{}) {
+	secret, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+	c.enqueueOwner(secret)
+}
+
+// objectFromTombstone returns the deleted object passed to a delete handler.
+// When the watch missed the deletion the informer passes a
+// DeletedFinalStateUnknown tombstone holding the last known state instead.
+func objectFromTombstone(obj interface{}) (v16.Object, bool) {
+	if object, ok := obj.(v16.Object); ok {
+		return object, true
+	}
+	tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("error decoding object, invalid type %T", obj))
+		return nil, false
+	}
+	object, ok := tombstone.Obj.(v16.Object)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type %T", tombstone.Obj))
+		return nil, false
+	}
+	return object, true
+}
+
+// enqueueOwner requeues the service controlling obj, so that a generated
+// ingress or secret which has been changed or deleted by someone else is put
+// back.
+func (c *controller) enqueueOwner(obj v16.Object) {
+	ownerReference := v16.GetControllerOf(obj)
 	if ownerReference == nil {
 		return
 	}
 	if ownerReference.Kind != "Service" {
 		return
 	}
-	c.queue.Add(ingress.Namespace + "/" + ingress.Name)
+	c.queue.Add(obj.GetNamespace() + "/" + ownerReference.Name)
 }
 
 func (c *controller) enqueue(obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
 		runtime.HandleError(err)
+		return
 	}
 	println("add key =" + key)
 	c.queue.Add(key)
 }
 
-func (c *controller) Run(stopCh chan struct{}) {
-	for i := 0; i < workNum; i++ {
-		go wait.Until(c.worker, time.Minute, stopCh)
+// Run syncs services until ctx is canceled. It then stops taking new work,
+// lets the workers finish the services already queued and returns.
+func (c *controller) Run(ctx context.Context) {
+	defer runtime.HandleCrash()
+
+	c.loadHostPaths()
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the worker only returns once the queue is shut down
+			wait.Until(c.worker, time.Second, ctx.Done())
+		}()
 	}
-	<-stopCh
+	<-ctx.Done()
+	klog.InfoS("Shutting down, draining the queue")
+	c.queue.ShutDownWithDrain()
+	wg.Wait()
 }
 
 func (c *controller) worker() {
 	for c.processNextItem() {
-		
+
 	}
 }
 
@@ -84,80 +277,408 @@ func (c *controller) processNextItem() bool {
 		return false
 	}
 	defer c.queue.Done(item)
-	
+
 	key := item.(string)
 	err := c.syncService(key)
 	if err != nil {
+		c.syncErrors.Inc()
 		c.handleError(key, err)
+		return true
 	}
+	c.queue.Forget(key)
 	return true
 
 }
 
 func (c *controller) syncService(key string) error {
 	namespaceKey, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		// a malformed key will never become valid, do not retry it
+		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+	// competitors are requeued once the service gives up its host and path
+	hostPath := ""
+	defer func() { c.setHostPath(key, hostPath) }()
+	if !c.namespaceAllowed(namespaceKey) {
+		// opted out namespaces are left alone, including ingresses generated earlier
+		return nil
+	}
 	//删除
 	service, err := c.serviceLister.Services(namespaceKey).Get(name)
 	if errors.IsNotFound(err) {
-		return nil
+		c.foreignSecrets.Delete(key)
+		// service deleted, remove the ingress and httproute generated for it
+		if c.output.httpRoute() {
+			if err := c.deleteHTTPRoute(namespaceKey, name); err != nil {
+				return err
+			}
+		}
+		return c.deleteOrphanedIngress(namespaceKey, name)
+	}
+
+	if err != nil {
+		return err
+	}
+	_, ok := service.GetAnnotations()[annotationHTTP]
+	if !ok {
+		if err := c.clearConflict(service); err != nil {
+			return err
+		}
+		if c.output.httpRoute() {
+			if err := c.deleteHTTPRoute(namespaceKey, name); err != nil {
+				return err
+			}
+		}
+		return c.deleteServiceIngress(service)
 	}
 
+	opts, err := parseAnnotations(service, c.hostTemplate)
 	if err != nil {
+		// retrying will not help, the service is requeued once its annotations change
+		c.recorder.Event(service, v17.EventTypeWarning, ReasonInvalidAnnotation, err.Error())
 		return nil
 	}
-	_, ok := service.GetAnnotations()["ingress/http"]
-	ingress, err := c.ingressLister.Ingresses(namespaceKey).Get(name)
-	if err !=nil && !errors.IsNotFound(err) {
+	var ingress *v15.Ingress
+	if c.output.ingress() {
+		ingress, err = c.desiredIngress(service, opts)
+		if err != nil || ingress == nil {
+			return err
+		}
+		// conflicts and the certificate are about the host and path the
+		// ingress template chose
+		opts.host, opts.path = renderedHostPath(ingress, opts)
+		if opts.tls && opts.host == "" {
+			c.recorder.Event(service, v17.EventTypeWarning, ReasonInvalidAnnotation,
+				fmt.Sprintf("%s requires a host, from %s, --host-template or the ingress template", annotationTLS, annotationHost))
+			return nil
+		}
+	}
+	hostPath = hostPathKey(opts.host, opts.path)
+	holder, losers, err := c.resolveHostPath(service, opts)
+	if err != nil {
+		return err
+	}
+	if holder != "" {
+		return c.reportConflict(service, opts, holder)
+	}
+	if err := c.clearConflict(service); err != nil {
+		return err
+	}
+	for _, loser := range losers {
+		c.queue.Add(loser)
+	}
+	if c.output.httpRoute() {
+		if err := c.syncHTTPRoute(service, opts); err != nil {
+			return err
+		}
+	}
+	if !c.output.ingress() {
+		return c.deleteServiceIngress(service)
+	}
+
+	if opts.selfSigned() && c.secretLister != nil {
+		renewIn, err := c.syncCertificate(service, opts)
+		if err != nil {
+			return err
+		}
+		if renewIn > 0 {
+			c.queue.AddAfter(key, renewIn)
+		}
+	} else if err := c.deleteCertificate(service); err != nil {
+		return err
+	}
+	return c.syncIngress(service, opts, ingress)
+}
+
+// syncIngress creates or updates the ingress of service to match ig.
+func (c *controller) syncIngress(service *v17.Service, opts ingressOptions, ig *v15.Ingress) error {
+	ingress, err := c.ingressLister.Ingresses(service.Namespace).Get(service.Name)
+	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-	if ok && errors.IsNotFound(err) {
+	if ingress == nil {
 		// create ingress
 		println("start to create ingress:" + service.Name)
-		ig := c.constructIngress(service)
-		_, err := c.client.NetworkingV1().Ingresses(namespaceKey).Create(context.TODO(), ig, v16.CreateOptions{})
+		_, err = c.client.NetworkingV1().Ingresses(service.Namespace).Create(context.TODO(), ig, v16.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		// a new ingress has no address yet
+		return c.clearAddress(service)
+	}
+	// update ingress, but never one we did not create
+	if !v16.IsControlledBy(ingress, service) {
+		return nil
+	}
+	if !ingressNeedsUpdate(ingress, ig) {
+		return c.syncAddress(service, ingress, opts)
+	}
+	klog.InfoS("Updating ingress", "namespace", service.Namespace, "name", service.Name)
+	updated := ingress.DeepCopy()
+	updated.Spec = ig.Spec
+	setManagedAnnotations(updated, ig.Annotations)
+	for key, value := range ig.Labels {
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		updated.Labels[key] = value
+	}
+	updated, err = c.client.NetworkingV1().Ingresses(service.Namespace).Update(context.TODO(), updated, v16.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	// the host or path may have changed the url
+	return c.syncAddress(service, updated, opts)
+}
+
+// deleteServiceIngress removes the ingress and certificate secret generated
+// for service, if there are any, and the address published for it.
+func (c *controller) deleteServiceIngress(service *v17.Service) error {
+	if err := c.deleteCertificate(service); err != nil {
 		return err
-	} else if !ok && ingress != nil {
-		// delete ingress
+	}
+	ingress, err := c.ingressLister.Ingresses(service.Namespace).Get(service.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	// delete ingress, but never one we did not create
+	if ingress != nil && v16.IsControlledBy(ingress, service) {
 		println("start to delete ingress:" + service.Name)
+		if err := c.removeIngress(ingress); err != nil {
+			return err
+		}
+	}
+	return c.clearAddress(service)
+}
+
+// ingressNeedsUpdate reports whether the spec of the existing ingress differs
+// from the desired one, or one of the desired labels or annotations, or one
+// of the managed annotations.
+func ingressNeedsUpdate(existing, desired *v15.Ingress) bool {
+	for _, key := range managedIngressAnnotations {
+		if existing.Annotations[key] != desired.Annotations[key] {
+			return true
+		}
+	}
+	for key, value := range desired.Annotations {
+		if existing.Annotations[key] != value {
+			return true
+		}
+	}
+	for key, value := range desired.Labels {
+		if existing.Labels[key] != value {
+			return true
+		}
+	}
+	return !equality.Semantic.DeepEqual(existing.Spec, desired.Spec)
+}
+
+// setManagedAnnotations makes the managed annotations of ingress match
+// desired and adds the other desired annotations, annotations added by
+// others are kept.
+func setManagedAnnotations(ingress *v15.Ingress, desired map[string]string) {
+	for key, value := range desired {
+		if ingress.Annotations == nil {
+			ingress.Annotations = map[string]string{}
+		}
+		ingress.Annotations[key] = value
+	}
+	for _, key := range managedIngressAnnotations {
+		value, ok := desired[key]
+		if !ok {
+			delete(ingress.Annotations, key)
+			continue
+		}
+		if ingress.Annotations == nil {
+			ingress.Annotations = map[string]string{}
+		}
+		ingress.Annotations[key] = value
+	}
+}
+
+// syncCertificate makes sure the self-signed certificate secret of service
+// holds a certificate for the host, and replaces it when it is about to
+// expire. It returns the time until the next renewal. A secret with the same
+// name not created by the controller is used as is.
+func (c *controller) syncCertificate(service *v17.Service, opts ingressOptions) (time.Duration, error) {
+	now := time.Now()
+	secret, err := c.secretLister.Secrets(service.Namespace).Get(opts.tlsSecretName)
+	if errors.IsNotFound(err) {
+		foreign, err := c.foreignSecret(service, opts)
+		if err != nil || foreign {
+			return 0, err
+		}
+		certPEM, keyPEM, err := generateSelfSignedCert(opts.host, now)
+		if err != nil {
+			return 0, err
+		}
+		klog.InfoS("Creating certificate secret", "namespace", service.Namespace, "name", opts.tlsSecretName)
+		secret = &v17.Secret{
+			ObjectMeta: v16.ObjectMeta{
+				Name:      opts.tlsSecretName,
+				Namespace: service.Namespace,
+				Labels:    map[string]string{managedByLabel: managedByValue},
+				OwnerReferences: []v16.OwnerReference{
+					*v16.NewControllerRef(service, schema.GroupVersionKind{Kind: "Service", Version: "v1", Group: ""}),
+				},
+			},
+			Type: v17.SecretTypeTLS,
+			Data: map[string][]byte{v17.TLSCertKey: certPEM, v17.TLSPrivateKeyKey: keyPEM},
+		}
+		_, err = c.client.CoreV1().Secrets(service.Namespace).Create(context.TODO(), secret, v16.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			// created by someone else since the lookup
+			c.foreignSecrets.Store(serviceKey(service), true)
+			return 0, nil
+		}
+		return certValidity - certRenewBefore, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !v16.IsControlledBy(secret, service) {
+		return 0, nil
+	}
+
+	renewAt, err := certRenewalTime(secret, opts.host)
+	if err == nil && now.Before(renewAt) {
+		return renewAt.Sub(now), nil
+	}
+	certPEM, keyPEM, err := generateSelfSignedCert(opts.host, now)
+	if err != nil {
+		return 0, err
+	}
+	klog.InfoS("Rotating certificate secret", "namespace", service.Namespace, "name", opts.tlsSecretName)
+	updated := secret.DeepCopy()
+	updated.Type = v17.SecretTypeTLS
+	updated.Data = map[string][]byte{v17.TLSCertKey: certPEM, v17.TLSPrivateKeyKey: keyPEM}
+	_, err = c.client.CoreV1().Secrets(service.Namespace).Update(context.TODO(), updated, v16.UpdateOptions{})
+	return certValidity - certRenewBefore, err
+}
+
+// deleteCertificate removes the self-signed certificate secret of service,
+// if the controller created one.
+// foreignSecret reports whether the certificate secret of service exists
+// without being visible to the secret lister, because someone else created
+// it. Such a secret is used as is. The answer is remembered, so that the
+// secret is only looked up once and not on every sync.
+func (c *controller) foreignSecret(service *v17.Service, opts ingressOptions) (bool, error) {
+	if _, ok := c.foreignSecrets.Load(serviceKey(service)); ok {
+		return true, nil
+	}
+	_, err := c.client.CoreV1().Secrets(service.Namespace).Get(context.TODO(), opts.tlsSecretName, v16.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.foreignSecrets.Store(serviceKey(service), true)
+	c.recorder.Eventf(service, v17.EventTypeNormal, ReasonSecretExists,
+		"Secret %s is not managed by ingress-manager, it is used as is", opts.tlsSecretName)
+	return true, nil
+}
+
+func serviceKey(service *v17.Service) string {
+	return service.Namespace + "/" + service.Name
+}
+
+func (c *controller) deleteCertificate(service *v17.Service) error {
+	// the secret is looked up again once a certificate is needed
+	c.foreignSecrets.Delete(serviceKey(service))
+	if c.secretLister == nil {
+		return nil
+	}
+	secret, err := c.secretLister.Secrets(service.Namespace).Get(tlsSecretName(service))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !v16.IsControlledBy(secret, service) {
+		return nil
 	}
+	klog.InfoS("Deleting certificate secret", "namespace", secret.Namespace, "name", secret.Name)
+	err = c.client.CoreV1().Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, v16.DeleteOptions{
+		Preconditions: &v16.Preconditions{UID: &secret.UID},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
 
-	return nil
+// deleteOrphanedIngress removes the ingress generated for a service which no
+// longer exists. The service is gone, so the owner reference is matched by
+// kind and name.
+func (c *controller) deleteOrphanedIngress(namespace, name string) error {
+	ingress, err := c.ingressLister.Ingresses(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ownerReference := v16.GetControllerOf(ingress)
+	if ownerReference == nil || ownerReference.Kind != "Service" || ownerReference.Name != name {
+		return nil
+	}
+	klog.InfoS("Deleting ingress of deleted service", "namespace", namespace, "name", name)
+	return c.removeIngress(ingress)
+}
 
+// removeIngress deletes the given ingress. The UID precondition makes sure an
+// ingress recreated in the meantime is left alone.
+func (c *controller) removeIngress(ingress *v15.Ingress) error {
+	err := c.client.NetworkingV1().Ingresses(ingress.Namespace).Delete(context.TODO(), ingress.Name, v16.DeleteOptions{
+		Preconditions: &v16.Preconditions{UID: &ingress.UID},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 func (c *controller) handleError(key string, err error) {
-	if c.queue.NumRequeues(key) <= maxRetry {
+	if c.queue.NumRequeues(key) <= c.maxRetries {
 		c.queue.AddRateLimited(key)
 		return
 	}
-	runtime.HandleError(err)
+	runtime.HandleError(fmt.Errorf("dropping service %q out of the queue: %v", key, err))
 	c.queue.Forget(key)
 }
 
-func (c *controller) constructIngress(service *v17.Service) *v15.Ingress {
+func (c *controller) constructIngress(service *v17.Service, opts ingressOptions) *v15.Ingress {
 	ingress := v15.Ingress{}
 	ingress.Name = service.Name
 	ingress.Namespace = service.Namespace
+	if len(opts.ingressAnnotations) > 0 {
+		ingress.Annotations = map[string]string{}
+		for k, v := range opts.ingressAnnotations {
+			ingress.Annotations[k] = v
+		}
+	}
 	ingress.ObjectMeta.OwnerReferences = []v16.OwnerReference{
 		*v16.NewControllerRef(service, schema.GroupVersionKind{Kind: "Service", Version: "v1", Group: ""}),
 	}
-	pathType := v15.PathTypePrefix
+	pathType := opts.pathType
 	ingress.Spec = v15.IngressSpec{
+		IngressClassName: opts.className,
 		Rules: []v15.IngressRule{
 			{
-				Host: "example.com",
+				Host: opts.host,
 				IngressRuleValue: v15.IngressRuleValue{
 					HTTP: &v15.HTTPIngressRuleValue{
 						Paths: []v15.HTTPIngressPath{
 							{
-								Path:     "/",
+								Path:     opts.path,
 								PathType: &pathType,
 								Backend: v15.IngressBackend{
 									Service: &v15.IngressServiceBackend{
 										Name: service.Name,
-										Port: v15.ServiceBackendPort{
-											Number: 80,
-										},
+										Port: opts.port,
 									},
 								},
 							},
@@ -167,26 +688,104 @@ func (c *controller) constructIngress(service *v17.Service) *v15.Ingress {
 			},
 		},
 	}
+	if opts.tls {
+		ingress.Spec.TLS = []v15.IngressTLS{
+			{
+				Hosts:      []string{opts.host},
+				SecretName: opts.tlsSecretName,
+			},
+		}
+	}
 
 	return &ingress
 }
 
-func NewController(client kubernetes.Interface, serviceInformer v13.ServiceInformer, ingressInformer v14.IngressInformer) controller {
+func NewController(client kubernetes.Interface, serviceInformer v13.ServiceInformer, ingressInformer v14.IngressInformer, config Config) controller {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v17.EventSource{Component: "ingress-manager"})
+
 	c := controller{
 		client:        client,
 		ingressLister: ingressInformer.Lister(),
 		serviceLister: serviceInformer.Lister(),
 		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ingressManage"),
+		recorder:      recorder,
+		output:        config.Output,
+		dynamicClient: config.DynamicClient,
+		gateway:       config.Gateway,
+		hostTemplate:  config.HostTemplate,
+		workers:       config.Workers,
+		maxRetries:    config.MaxRetries,
+		syncErrors:    newSyncErrorsCounter(),
+		namespaces:    config.Namespaces,
+		hostPaths:     newHostPaths(),
+
+		foreignSecrets: &sync.Map{},
+	}
+	templateHandlers := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addConfigMap,
+		UpdateFunc: c.updateConfigMap,
+		DeleteFunc: c.deleteConfigMap,
+	}
+	if config.ConfigMapInformer != nil {
+		c.configMapLister = config.ConfigMapInformer.Lister()
+		config.ConfigMapInformer.Informer().AddEventHandler(templateHandlers)
+	}
+	if config.DefaultTemplate.Name != "" {
+		c.defaultTemplate = config.DefaultTemplate
+		c.defaultTemplateLister = config.DefaultTemplateInformer.Lister()
+		config.DefaultTemplateInformer.Informer().AddEventHandler(templateHandlers)
+	}
+	if config.Namespaces.Selector != nil && !config.Namespaces.Selector.Empty() {
+		c.namespaceLister = config.NamespaceInformer.Lister()
+		config.NamespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.addNamespace,
+			UpdateFunc: c.updateNamespace,
+		})
+	}
+	if c.workers <= 0 {
+		c.workers = workNum
+	}
+	if c.maxRetries <= 0 {
+		c.maxRetries = maxRetry
+	}
+	if err := serviceInformer.Informer().AddIndexers(cache.Indexers{
+		templateIndex: serviceTemplateIndexFunc,
+	}); err != nil {
+		runtime.HandleError(err)
+	}
+	if err := ingressInformer.Informer().AddIndexers(cache.Indexers{hostPathIndex: ingressHostPathIndexFunc}); err != nil {
+		runtime.HandleError(err)
+	}
+	c.serviceIndexer = serviceInformer.Informer().GetIndexer()
+	c.ingressIndexer = ingressInformer.Informer().GetIndexer()
+	if c.output.httpRoute() {
+		c.routeLister = config.RouteInformer.Lister()
+		config.RouteInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.updateRoute,
+			DeleteFunc: c.deleteRoute,
+		})
 	}
 
 	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    c.addService,
 		UpdateFunc: c.updateService,
+		DeleteFunc: c.deleteService,
 	})
 
 	ingressInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.updateIngress,
 		DeleteFunc: c.deleteIngress,
 	})
+
+	if config.SecretInformer != nil {
+		c.secretLister = config.SecretInformer.Lister()
+		config.SecretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.updateSecret,
+			DeleteFunc: c.deleteSecret,
+		})
+	}
 	return c
 
 }
@@ -0,0 +1,758 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+type fixture struct {
+	t *testing.T
+
+	client        *k8sfake.Clientset
+	dynamicClient *dynamicfake.FakeDynamicClient
+	// Objects to put in the store.
+	serviceLister []*v17.Service
+	ingressLister []*v15.Ingress
+	secretLister  []*v17.Secret
+	routeLister   []*unstructured.Unstructured
+	// configMapLister is only used with templates enabled.
+	configMapLister []*v17.ConfigMap
+	templates       bool
+	// noSecrets leaves Config.SecretInformer unset, disabling self-signed
+	// certificates.
+	noSecrets bool
+	// Actions expected to happen on the clients.
+	actions        []core.Action
+	dynamicActions []core.Action
+	// Objects from here preloaded into NewSimpleClientset.
+	objects []runtime.Object
+	// config is passed to NewController, the dynamic client and route
+	// informer are filled in by the fixture.
+	config   Config
+	recorder *record.FakeRecorder
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{}
+	f.t = t
+	f.objects = []runtime.Object{}
+	f.recorder = record.NewFakeRecorder(10)
+	return f
+}
+
+func newService(name string, annotations map[string]string) *v17.Service {
+	return &v17.Service{
+		ObjectMeta: v16.ObjectMeta{
+			Name:        name,
+			Namespace:   v16.NamespaceDefault,
+			UID:         types.UID(name + "-uid"),
+			Annotations: annotations,
+		},
+		Spec: v17.ServiceSpec{
+			Ports: []v17.ServicePort{{Name: "http", Port: 8080}},
+		},
+	}
+}
+
+// newIngress returns the ingress expected for service with the given host.
+func newIngress(service *v17.Service, host string) *v15.Ingress {
+	pathType := v15.PathTypePrefix
+	return &v15.Ingress{
+		ObjectMeta: v16.ObjectMeta{
+			Name:      service.Name,
+			Namespace: service.Namespace,
+			OwnerReferences: []v16.OwnerReference{
+				*v16.NewControllerRef(service, schema.GroupVersionKind{Version: "v1", Kind: "Service"}),
+			},
+		},
+		Spec: v15.IngressSpec{
+			Rules: []v15.IngressRule{{
+				Host: host,
+				IngressRuleValue: v15.IngressRuleValue{
+					HTTP: &v15.HTTPIngressRuleValue{
+						Paths: []v15.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: v15.IngressBackend{
+								Service: &v15.IngressServiceBackend{
+									Name: service.Name,
+									Port: v15.ServiceBackendPort{Name: "http"},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+// newRoute returns the HTTPRoute expected for service with the given host,
+// attached to the gateway infra/public.
+func newRoute(service *v17.Service, host string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":      service.Name,
+			"namespace": service.Namespace,
+			"ownerReferences": []interface{}{map[string]interface{}{
+				"apiVersion":         "v1",
+				"kind":               "Service",
+				"name":               service.Name,
+				"uid":                string(service.UID),
+				"controller":         true,
+				"blockOwnerDeletion": true,
+			}},
+		},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{
+				"group":     "gateway.networking.k8s.io",
+				"kind":      "Gateway",
+				"name":      "public",
+				"namespace": "infra",
+			}},
+			"hostnames": []interface{}{host},
+			"rules": []interface{}{map[string]interface{}{
+				"matches": []interface{}{map[string]interface{}{
+					"path": map[string]interface{}{"type": "PathPrefix", "value": "/"},
+				}},
+				"backendRefs": []interface{}{map[string]interface{}{
+					"group":  "",
+					"kind":   "Service",
+					"name":   service.Name,
+					"port":   int64(8080),
+					"weight": int64(1),
+				}},
+			}},
+		},
+	}}
+}
+
+func (f *fixture) newController() (*controller, informers.SharedInformerFactory) {
+	f.client = k8sfake.NewSimpleClientset(f.objects...)
+	f.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{HTTPRouteGVR: "HTTPRouteList"})
+
+	i := informers.NewSharedInformerFactory(f.client, 0)
+	config := f.config
+	if config.Output.httpRoute() {
+		config.DynamicClient = f.dynamicClient
+		config.RouteInformer = dynamicinformer.NewDynamicSharedInformerFactory(f.dynamicClient, 0).ForResource(HTTPRouteGVR)
+		for _, r := range f.routeLister {
+			config.RouteInformer.Informer().GetIndexer().Add(r)
+		}
+	}
+
+	if f.templates {
+		config.ConfigMapInformer = i.Core().V1().ConfigMaps()
+		if config.DefaultTemplate.Name != "" {
+			config.DefaultTemplateInformer = config.ConfigMapInformer
+		}
+		for _, cm := range f.configMapLister {
+			config.ConfigMapInformer.Informer().GetIndexer().Add(cm)
+		}
+	}
+
+	if !f.noSecrets {
+		config.SecretInformer = i.Core().V1().Secrets()
+	}
+
+	c := NewController(f.client, i.Core().V1().Services(), i.Networking().V1().Ingresses(), config)
+	c.recorder = f.recorder
+
+	for _, s := range f.serviceLister {
+		i.Core().V1().Services().Informer().GetIndexer().Add(s)
+	}
+	for _, ing := range f.ingressLister {
+		i.Networking().V1().Ingresses().Informer().GetIndexer().Add(ing)
+	}
+	for _, s := range f.secretLister {
+		i.Core().V1().Secrets().Informer().GetIndexer().Add(s)
+	}
+	// as Run does once the caches are synced
+	c.loadHostPaths()
+	return &c, i
+}
+
+func (f *fixture) run(key string) {
+	c, _ := f.newController()
+	if err := c.syncService(key); err != nil {
+		f.t.Errorf("error syncing service: %v", err)
+	}
+	checkActions(f.t, f.actions, f.client.Actions())
+	checkActions(f.t, f.dynamicActions, f.dynamicClient.Actions())
+}
+
+func checkActions(t *testing.T, expected, actual []core.Action) {
+	t.Helper()
+	for i, action := range actual {
+		if len(expected) < i+1 {
+			t.Errorf("%d unexpected actions: %+v", len(actual)-len(expected), actual[i:])
+			break
+		}
+		checkAction(expected[i], action, t)
+	}
+	if len(expected) > len(actual) {
+		t.Errorf("%d additional expected actions: %+v", len(expected)-len(actual), expected[len(actual):])
+	}
+}
+
+// checkAction verifies that expected and actual actions are equal and both have
+// same attached resources. An expected create or update without an object
+// only checks the verb and resource.
+func checkAction(expected, actual core.Action, t *testing.T) {
+	t.Helper()
+	if !(expected.Matches(actual.GetVerb(), actual.GetResource().Resource) && actual.GetNamespace() == expected.GetNamespace()) {
+		t.Errorf("Expected\n\t%#v\ngot\n\t%#v", expected, actual)
+		return
+	}
+
+	if reflect.TypeOf(actual) != reflect.TypeOf(expected) {
+		t.Errorf("Action has wrong type. Expected: %t. Got: %t", expected, actual)
+		return
+	}
+
+	switch a := actual.(type) {
+	case core.CreateActionImpl:
+		e, _ := expected.(core.CreateActionImpl)
+		if e.GetObject() != nil && !reflect.DeepEqual(e.GetObject(), a.GetObject()) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(e.GetObject(), a.GetObject()))
+		}
+	case core.UpdateActionImpl:
+		e, _ := expected.(core.UpdateActionImpl)
+		if e.GetObject() != nil && !reflect.DeepEqual(e.GetObject(), a.GetObject()) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(e.GetObject(), a.GetObject()))
+		}
+	case core.PatchActionImpl:
+		e, _ := expected.(core.PatchActionImpl)
+		if e.GetName() != a.GetName() || string(e.GetPatch()) != string(a.GetPatch()) {
+			t.Errorf("Action %s %s has wrong patch\nexpected %s %s\ngot %s %s",
+				a.GetVerb(), a.GetResource().Resource, e.GetName(), e.GetPatch(), a.GetName(), a.GetPatch())
+		}
+	case core.GetActionImpl:
+		e, _ := expected.(core.GetActionImpl)
+		if e.GetName() != a.GetName() {
+			t.Errorf("Action %s %s has wrong name, expected %q, got %q",
+				a.GetVerb(), a.GetResource().Resource, e.GetName(), a.GetName())
+		}
+	case core.DeleteActionImpl:
+		e, _ := expected.(core.DeleteActionImpl)
+		if e.GetName() != a.GetName() {
+			t.Errorf("Action %s %s has wrong name, expected %q, got %q",
+				a.GetVerb(), a.GetResource().Resource, e.GetName(), a.GetName())
+		}
+	default:
+		t.Errorf("Uncaptured Action %s %s, you should explicitly add a case to capture it",
+			actual.GetVerb(), actual.GetResource().Resource)
+	}
+}
+
+func (f *fixture) expectCreateIngressAction(ing *v15.Ingress) {
+	f.actions = append(f.actions, core.NewCreateAction(schema.GroupVersionResource{Resource: "ingresses"}, ing.Namespace, ing))
+}
+
+func (f *fixture) expectUpdateIngressAction(ing *v15.Ingress) {
+	f.actions = append(f.actions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "ingresses"}, ing.Namespace, ing))
+}
+
+func (f *fixture) expectDeleteIngressAction(ing *v15.Ingress) {
+	f.actions = append(f.actions, core.NewDeleteAction(schema.GroupVersionResource{Resource: "ingresses"}, ing.Namespace, ing.Name))
+}
+
+func (f *fixture) expectConflictPatchAction(s *v17.Service, message string) {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annotationConflict, message)
+	f.actions = append(f.actions, core.NewPatchAction(schema.GroupVersionResource{Resource: "services"}, s.Namespace, s.Name, types.MergePatchType, []byte(patch)))
+}
+
+// expectCreateSecretAction expects the certificate secret name to be looked
+// up, as the secret lister only sees labeled secrets, and then created.
+func (f *fixture) expectCreateSecretAction(namespace, name string) {
+	f.expectGetSecretAction(namespace, name)
+	f.actions = append(f.actions, core.NewCreateAction(schema.GroupVersionResource{Resource: "secrets"}, namespace, nil))
+}
+
+func (f *fixture) expectGetSecretAction(namespace, name string) {
+	f.actions = append(f.actions, core.NewGetAction(schema.GroupVersionResource{Resource: "secrets"}, namespace, name))
+}
+
+func (f *fixture) expectCreateRouteAction(route *unstructured.Unstructured) {
+	f.dynamicActions = append(f.dynamicActions, core.NewCreateAction(HTTPRouteGVR, route.GetNamespace(), route))
+}
+
+func TestCreateIngress(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.expectCreateIngressAction(newIngress(s, "test.example.com"))
+	f.run("default/test")
+}
+
+func TestDoNothing(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	ing := newIngress(s, "test.example.com")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	f.run("default/test")
+}
+
+func TestUpdateIngress(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "new.example.com"})
+	ing := newIngress(s, "old.example.com")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	f.expectUpdateIngressAction(newIngress(s, "new.example.com"))
+	f.run("default/test")
+}
+
+func TestDeleteIngressWhenAnnotationRemoved(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", nil)
+	ing := newIngress(s, "")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	f.expectDeleteIngressAction(ing)
+	f.run("default/test")
+}
+
+func TestDeleteIngressOfDeletedService(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true"})
+	ing := newIngress(s, "")
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, ing)
+
+	f.expectDeleteIngressAction(ing)
+	f.run("default/test")
+}
+
+func TestIngressNotControlledByUs(t *testing.T) {
+	for name, annotations := range map[string]map[string]string{
+		"annotated":     {annotationHTTP: "true", annotationHost: "new.example.com"},
+		"not annotated": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t)
+			s := newService("test", annotations)
+			ing := newIngress(s, "old.example.com")
+			ing.OwnerReferences = nil
+			f.serviceLister = append(f.serviceLister, s)
+			f.ingressLister = append(f.ingressLister, ing)
+			f.objects = append(f.objects, s, ing)
+
+			f.run("default/test")
+		})
+	}
+}
+
+func TestInvalidAnnotation(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationPort: "9090"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.run("default/test")
+
+	select {
+	case event := <-f.recorder.Events:
+		if !strings.HasPrefix(event, v17.EventTypeWarning+" "+ReasonInvalidAnnotation) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the invalid annotation")
+	}
+}
+
+func TestSelfSignedTLS(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTLS: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	ing := newIngress(s, "test.example.com")
+	ing.Spec.TLS = []v15.IngressTLS{{Hosts: []string{"test.example.com"}, SecretName: "test-tls"}}
+	f.expectCreateSecretAction(s.Namespace, "test-tls")
+	f.expectCreateIngressAction(ing)
+	f.run("default/test")
+
+	obj := f.client.Actions()[1].(core.CreateAction).GetObject()
+	secret := obj.(*v17.Secret)
+	if secret.Name != "test-tls" || secret.Type != v17.SecretTypeTLS || !v16.IsControlledBy(secret, s) {
+		t.Fatalf("unexpected secret %s of type %s", secret.Name, secret.Type)
+	}
+	// the secret informer only lists labeled secrets
+	if secret.Labels[managedByLabel] != managedByValue {
+		t.Errorf("secret has labels %v, want %s", secret.Labels, CertificateSecretSelector)
+	}
+	renewAt, err := certRenewalTime(secret, "test.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Now().Add(certValidity - certRenewBefore); renewAt.After(want) || renewAt.Before(want.Add(-time.Hour)) {
+		t.Errorf("certificate renews at %v, want about %v", renewAt, want)
+	}
+}
+
+func TestForeignTLSSecret(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTLS: "true"})
+	// unlabeled, so the secret lister does not see it
+	secret := &v17.Secret{ObjectMeta: v16.ObjectMeta{Name: "test-tls", Namespace: s.Namespace}}
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s, secret)
+
+	c, _ := f.newController()
+	opts, err := parseAnnotations(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if renewIn, err := c.syncCertificate(s, opts); err != nil || renewIn != 0 {
+			t.Fatalf("sync %d: got renewal in %v and error %v, want neither", i, renewIn, err)
+		}
+	}
+	// the secret is looked up once, and never replaced
+	f.expectGetSecretAction(s.Namespace, "test-tls")
+	checkActions(t, f.actions, f.client.Actions())
+
+	select {
+	case event := <-f.recorder.Events:
+		if !strings.HasPrefix(event, v17.EventTypeNormal+" "+ReasonSecretExists) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the foreign secret")
+	}
+}
+
+func TestSelfSignedTLSDisabled(t *testing.T) {
+	f := newFixture(t)
+	f.noSecrets = true
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTLS: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	// the ingress refers to a secret provided by someone else
+	ing := newIngress(s, "test.example.com")
+	ing.Spec.TLS = []v15.IngressTLS{{Hosts: []string{"test.example.com"}, SecretName: "test-tls"}}
+	f.expectCreateIngressAction(ing)
+	f.run("default/test")
+}
+
+func TestHTTPRouteOutput(t *testing.T) {
+	f := newFixture(t)
+	f.config = Config{Output: OutputHTTPRoute, Gateway: types.NamespacedName{Namespace: "infra", Name: "public"}}
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	// switching to httproute output removes the generated ingress
+	ing := newIngress(s, "test.example.com")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	f.expectCreateRouteAction(newRoute(s, "test.example.com"))
+	f.expectDeleteIngressAction(ing)
+	f.run("default/test")
+}
+
+func TestHTTPRouteUpToDate(t *testing.T) {
+	f := newFixture(t)
+	f.config = Config{Output: OutputHTTPRoute, Gateway: types.NamespacedName{Namespace: "infra", Name: "public"}}
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	// as stored by the API server, which defaults the references
+	route := newRoute(s, "test.example.com")
+	route.SetResourceVersion("1")
+	route.SetUID("route-uid")
+	route.Object["status"] = map[string]interface{}{"parents": []interface{}{}}
+	f.routeLister = append(f.routeLister, route)
+
+	f.run("default/test")
+}
+
+func TestHostTemplate(t *testing.T) {
+	f := newFixture(t)
+	f.config = Config{HostTemplate: template.Must(template.New("host").Parse("{{.Name}}.{{.Namespace}}.apps.example.com"))}
+	s := newService("test", map[string]string{annotationHTTP: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.expectCreateIngressAction(newIngress(s, "test.default.apps.example.com"))
+	f.run("default/test")
+}
+
+func TestHostConflict(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "shared.example.com"})
+	other := newService("other", nil)
+	other.Namespace = "other"
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, newIngress(other, "shared.example.com"))
+	f.objects = append(f.objects, s)
+
+	f.expectConflictPatchAction(s, `host "shared.example.com" and path "/" are used by ingress other/other`)
+	f.run("default/test")
+
+	select {
+	case event := <-f.recorder.Events:
+		if !strings.HasPrefix(event, v17.EventTypeWarning+" "+ReasonHostConflict) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the conflict")
+	}
+}
+
+func TestOldestServiceWins(t *testing.T) {
+	annotations := map[string]string{annotationHTTP: "true", annotationHost: "shared.example.com"}
+	older := newService("older", annotations)
+	older.CreationTimestamp = v16.NewTime(time.Now().Add(-time.Hour))
+	newer := newService("newer", annotations)
+	newer.CreationTimestamp = v16.NewTime(time.Now())
+
+	t.Run("loser", func(t *testing.T) {
+		f := newFixture(t)
+		// the newer service got its ingress before the older one was annotated
+		ing := newIngress(newer, "shared.example.com")
+		f.serviceLister = append(f.serviceLister, older, newer)
+		f.ingressLister = append(f.ingressLister, ing)
+		f.objects = append(f.objects, older, newer, ing)
+
+		f.expectConflictPatchAction(newer, `host "shared.example.com" and path "/" are used by service default/older`)
+		f.expectDeleteIngressAction(ing)
+		f.run("default/newer")
+	})
+
+	t.Run("winner", func(t *testing.T) {
+		f := newFixture(t)
+		f.serviceLister = append(f.serviceLister, older, newer)
+		f.ingressLister = append(f.ingressLister, newIngress(newer, "shared.example.com"))
+		f.objects = append(f.objects, older, newer)
+
+		f.expectCreateIngressAction(newIngress(older, "shared.example.com"))
+		c, _ := f.newController()
+		if err := c.syncService("default/older"); err != nil {
+			t.Fatalf("error syncing service: %v", err)
+		}
+		checkActions(t, f.actions, f.client.Actions())
+		// the loser is requeued to give up the host
+		if c.queue.Len() != 1 {
+			t.Fatalf("expected the losing service to be requeued, queue length %d", c.queue.Len())
+		}
+		if item, _ := c.queue.Get(); item != "default/newer" {
+			t.Errorf("requeued %v, want default/newer", item)
+		}
+	})
+}
+
+func TestReleasedHostRequeuesPeers(t *testing.T) {
+	annotations := map[string]string{annotationHTTP: "true", annotationHost: "shared.example.com"}
+	winner := newService("winner", annotations)
+	winner.CreationTimestamp = v16.NewTime(time.Now().Add(-time.Hour))
+	loser := newService("loser", annotations)
+	loser.CreationTimestamp = v16.NewTime(time.Now())
+
+	f := newFixture(t)
+	f.serviceLister = append(f.serviceLister, winner, loser)
+	f.objects = append(f.objects, winner, loser)
+	c, _ := f.newController()
+	// the winner gives up the host
+	winner = winner.DeepCopy()
+	winner.Annotations = map[string]string{annotationHTTP: "true", annotationHost: "winner.example.com"}
+	c.serviceIndexer.Update(winner)
+	if err := c.syncService("default/winner"); err != nil {
+		t.Fatalf("error syncing service: %v", err)
+	}
+
+	if c.queue.Len() != 1 {
+		t.Fatalf("expected the waiting service to be requeued, queue length %d", c.queue.Len())
+	}
+	if item, _ := c.queue.Get(); item != "default/loser" {
+		t.Errorf("requeued %v, want default/loser", item)
+	}
+}
+
+func TestExcludedNamespace(t *testing.T) {
+	f := newFixture(t)
+	f.config = Config{Namespaces: NamespaceFilter{Exclude: []string{v16.NamespaceDefault}}}
+	s := newService("test", map[string]string{annotationHTTP: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.run("default/test")
+}
+
+func TestPublishAddress(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	ing := newIngress(s, "test.example.com")
+	ing.Status.LoadBalancer.Ingress = []v17.LoadBalancerIngress{{IP: "192.0.2.10"}}
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	patch := `{"metadata":{"annotations":{"ingress/address":"192.0.2.10","ingress/url":"http://test.example.com/"}}}`
+	f.actions = append(f.actions, core.NewPatchAction(schema.GroupVersionResource{Resource: "services"}, s.Namespace, s.Name, types.MergePatchType, []byte(patch)))
+	f.run("default/test")
+
+	select {
+	case event := <-f.recorder.Events:
+		if want := "Normal IngressReady Reachable at http://test.example.com/ (address 192.0.2.10)"; event != want {
+			t.Errorf("got event %q, want %q", event, want)
+		}
+	default:
+		t.Error("expected an event for the address")
+	}
+}
+
+func TestClearAddressWhenIngressRemoved(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationAddress: "192.0.2.10", annotationURL: "http://test.example.com/"})
+	ing := newIngress(s, "test.example.com")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.objects = append(f.objects, s, ing)
+
+	f.expectDeleteIngressAction(ing)
+	patch := `{"metadata":{"annotations":{"ingress/address":null,"ingress/url":null}}}`
+	f.actions = append(f.actions, core.NewPatchAction(schema.GroupVersionResource{Resource: "services"}, s.Namespace, s.Name, types.MergePatchType, []byte(patch)))
+	f.run("default/test")
+}
+
+func TestInvalidKey(t *testing.T) {
+	f := newFixture(t)
+	c, _ := f.newController()
+	if err := c.syncService("a/b/c"); err != nil {
+		t.Errorf("expected invalid key to be dropped, got %v", err)
+	}
+}
+
+func TestSyncErrorIsRetried(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+	c, _ := f.newController()
+	f.client.PrependReactor("create", "ingresses", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("boom")
+	})
+
+	c.queue.Add("default/test")
+	c.processNextItem()
+	if got := c.queue.NumRequeues("default/test"); got != 1 {
+		t.Errorf("expected the service to be requeued once, got %d", got)
+	}
+}
+
+func TestRunDrainsQueueOnShutdown(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+	c, _ := f.newController()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	f.client.PrependReactor("create", "ingresses", func(action core.Action) (bool, runtime.Object, error) {
+		close(started)
+		<-release
+		return false, nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	c.queue.Add("default/test")
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Run returned before the in-flight sync finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("Run did not return after the queue was drained")
+	}
+	if _, err := f.client.NetworkingV1().Ingresses("default").Get(context.Background(), "test", v16.GetOptions{}); err != nil {
+		t.Errorf("expected the ingress to be created: %v", err)
+	}
+}
+
+func TestDeleteHandlersEnqueueOwner(t *testing.T) {
+	s := newService("owner", nil)
+	owned := newIngress(s, "")
+	owned.Name = "other-name"
+	notOwned := newIngress(s, "")
+	notOwned.OwnerReferences = nil
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		want []string
+	}{
+		{name: "ingress", obj: owned, want: []string{"default/owner"}},
+		{name: "tombstone", obj: cache.DeletedFinalStateUnknown{Key: "default/other-name", Obj: owned}, want: []string{"default/owner"}},
+		{name: "not owned", obj: notOwned},
+		{name: "invalid tombstone", obj: cache.DeletedFinalStateUnknown{Key: "default/other-name", Obj: "garbage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			c, _ := f.newController()
+			c.deleteIngress(tt.obj)
+
+			var got []string
+			for c.queue.Len() > 0 {
+				item, _ := c.queue.Get()
+				got = append(got, item.(string))
+				c.queue.Done(item)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got queue %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// HTTPRouteGVR is the Gateway API resource generated in OutputHTTPRoute mode.
+// It is handled with the dynamic client, so no Gateway API types are needed.
+var HTTPRouteGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+// Output selects what is generated for an annotated service.
+type Output string
+
+const (
+	OutputIngress   Output = "ingress"
+	OutputHTTPRoute Output = "httproute"
+	OutputBoth      Output = "both"
+)
+
+// ParseOutput validates the value of the --output flag.
+func ParseOutput(value string) (Output, error) {
+	switch o := Output(value); o {
+	case OutputIngress, OutputHTTPRoute, OutputBoth:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unsupported output %q, must be one of ingress, httproute, both", value)
+	}
+}
+
+func (o Output) ingress() bool {
+	return o == "" || o == OutputIngress || o == OutputBoth
+}
+
+func (o Output) httpRoute() bool {
+	return o == OutputHTTPRoute || o == OutputBoth
+}
+
+// gatewayPathTypes maps ingress path types to HTTPRoute path match types.
+// Gateway API has no implementation specific type, it is treated as prefix.
+var gatewayPathTypes = map[v15.PathType]string{
+	v15.PathTypeExact:                  "Exact",
+	v15.PathTypePrefix:                 "PathPrefix",
+	v15.PathTypeImplementationSpecific: "PathPrefix",
+}
+
+// syncHTTPRoute creates or updates the HTTPRoute of service.
+func (c *controller) syncHTTPRoute(service *v17.Service, opts ingressOptions) error {
+	desired, err := c.constructHTTPRoute(service, opts)
+	if err != nil {
+		return err
+	}
+	obj, err := c.routeLister.ByNamespace(service.Namespace).Get(service.Name)
+	if errors.IsNotFound(err) {
+		klog.InfoS("Creating httproute", "namespace", service.Namespace, "name", service.Name)
+		_, err = c.dynamicClient.Resource(HTTPRouteGVR).Namespace(service.Namespace).Create(context.TODO(), desired, v16.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	route := obj.(*unstructured.Unstructured)
+	// update httproute, but never one we did not create
+	if !v16.IsControlledBy(route, service) || equality.Semantic.DeepEqual(route.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	klog.InfoS("Updating httproute", "namespace", service.Namespace, "name", service.Name)
+	updated := route.DeepCopy()
+	updated.Object["spec"] = desired.Object["spec"]
+	_, err = c.dynamicClient.Resource(HTTPRouteGVR).Namespace(service.Namespace).Update(context.TODO(), updated, v16.UpdateOptions{})
+	return err
+}
+
+// deleteHTTPRoute removes the HTTPRoute generated for the service namespace/name.
+// The service may be gone already, so the owner reference is matched by kind
+// and name.
+func (c *controller) deleteHTTPRoute(namespace, name string) error {
+	obj, err := c.routeLister.ByNamespace(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	route := obj.(*unstructured.Unstructured)
+	ownerReference := v16.GetControllerOf(route)
+	if ownerReference == nil || ownerReference.Kind != "Service" || ownerReference.Name != name {
+		return nil
+	}
+	klog.InfoS("Deleting httproute", "namespace", namespace, "name", name)
+	uid := route.GetUID()
+	err = c.dynamicClient.Resource(HTTPRouteGVR).Namespace(namespace).Delete(context.TODO(), name, v16.DeleteOptions{
+		Preconditions: &v16.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// constructHTTPRoute builds the HTTPRoute for service, attached to the
+// configured gateway. TLS is terminated by the gateway listener, so the tls
+// annotations do not apply here.
+func (c *controller) constructHTTPRoute(service *v17.Service, opts ingressOptions) (*unstructured.Unstructured, error) {
+	port, err := servicePortNumber(service, opts.port)
+	if err != nil {
+		return nil, err
+	}
+
+	// The references carry the values the API server defaults, otherwise
+	// the stored route never equals the desired one and is updated on every
+	// sync.
+	parentRef := map[string]interface{}{
+		"group": HTTPRouteGVR.Group,
+		"kind":  "Gateway",
+		"name":  c.gateway.Name,
+	}
+	if c.gateway.Namespace != "" {
+		parentRef["namespace"] = c.gateway.Namespace
+	}
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":  gatewayPathTypes[opts.pathType],
+							"value": opts.path,
+						},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"group":  "",
+						"kind":   "Service",
+						"name":   service.Name,
+						"port":   int64(port),
+						"weight": int64(1),
+					},
+				},
+			},
+		},
+	}
+	if opts.host != "" {
+		spec["hostnames"] = []interface{}{opts.host}
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetAPIVersion(HTTPRouteGVR.GroupVersion().String())
+	route.SetKind("HTTPRoute")
+	route.SetName(service.Name)
+	route.SetNamespace(service.Namespace)
+	route.SetOwnerReferences([]v16.OwnerReference{
+		*v16.NewControllerRef(service, schema.GroupVersionKind{Kind: "Service", Version: "v1", Group: ""}),
+	})
+	return route, nil
+}
+
+// servicePortNumber resolves a backend port to a port number, HTTPRoute
+// backends can not refer to ports by name.
+func servicePortNumber(service *v17.Service, port v15.ServiceBackendPort) (int32, error) {
+	if port.Name == "" {
+		return port.Number, nil
+	}
+	for _, p := range service.Spec.Ports {
+		if p.Name == port.Name {
+			return p.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s/%s has no port %q", service.Namespace, service.Name, port.Name)
+}
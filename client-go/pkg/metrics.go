@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const metricsNamespace = "ingress_manager"
+
+// newSyncErrorsCounter counts failed syncs, each retry counts again.
+func newSyncErrorsCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sync_errors_total",
+		Help:      "Number of service syncs which returned an error.",
+	})
+}
+
+// RegisterMetrics registers the controller metrics with registerer: the
+// queue depth, the sync errors and the number of generated ingresses.
+func (c *controller) RegisterMetrics(registerer prometheus.Registerer) error {
+	queue := c.queue
+	ingressLister := c.ingressLister
+	collectors := []prometheus.Collector{
+		c.syncErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "queue_depth",
+			Help:      "Number of services waiting to be synced.",
+		}, func() float64 {
+			return float64(queue.Len())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "generated_ingresses",
+			Help:      "Number of ingresses controlled by a service.",
+		}, func() float64 {
+			ingresses, err := ingressLister.List(labels.Everything())
+			if err != nil {
+				return 0
+			}
+			count := 0
+			for _, ingress := range ingresses {
+				if ownerReference := v16.GetControllerOf(ingress); ownerReference != nil && ownerReference.Kind == "Service" {
+					count++
+				}
+			}
+			return float64(count)
+		}),
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"strings"
+
+	v17 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	v12 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceFilter selects the namespaces the controller acts in. A namespace
+// has to be in Include, if it is not empty, must not be in Exclude, and its
+// labels have to match Selector, if it is set.
+type NamespaceFilter struct {
+	Include  []string
+	Exclude  []string
+	Selector labels.Selector
+}
+
+// InformerOptions narrows what the informers list and watch as far as the
+// API allows: a single included namespace is watched alone, excluded
+// namespaces are filtered with a field selector. The rest of the filter is
+// only applied when syncing.
+func (f NamespaceFilter) InformerOptions() []informers.SharedInformerOption {
+	var options []informers.SharedInformerOption
+	if namespace := f.InformerNamespace(); namespace != v16.NamespaceAll {
+		options = append(options, informers.WithNamespace(namespace))
+	}
+	if len(f.Exclude) > 0 {
+		options = append(options, informers.WithTweakListOptions(f.TweakListOptions))
+	}
+	return options
+}
+
+// InformerNamespace returns the only namespace to watch, or NamespaceAll.
+func (f NamespaceFilter) InformerNamespace() string {
+	if len(f.Include) == 1 {
+		return f.Include[0]
+	}
+	return v16.NamespaceAll
+}
+
+// TweakListOptions excludes the objects of the excluded namespaces.
+func (f NamespaceFilter) TweakListOptions(options *v16.ListOptions) {
+	var selectors []string
+	for _, namespace := range f.Exclude {
+		selectors = append(selectors, "metadata.namespace!="+namespace)
+	}
+	if options.FieldSelector != "" {
+		selectors = append(selectors, options.FieldSelector)
+	}
+	options.FieldSelector = strings.Join(selectors, ",")
+}
+
+// allows reports whether the controller may act in namespace. The labels
+// are looked up with namespaceLister, which is only needed with a selector.
+func (f NamespaceFilter) allows(namespace string, namespaceLister v12.NamespaceLister) (bool, error) {
+	if len(f.Include) > 0 && !contains(f.Include, namespace) {
+		return false, nil
+	}
+	if contains(f.Exclude, namespace) {
+		return false, nil
+	}
+	if f.Selector == nil || f.Selector.Empty() {
+		return true, nil
+	}
+	ns, err := namespaceLister.Get(namespace)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return f.Selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceAllowed reports whether services in namespace are synced.
+func (c *controller) namespaceAllowed(namespace string) bool {
+	allowed, err := c.namespaces.allows(namespace, c.namespaceLister)
+	if err != nil {
+		runtime.HandleError(err)
+		return false
+	}
+	return allowed
+}
+
+func (c *controller) addNamespace(obj interface{}) {
+	c.enqueueNamespace(obj.(*v17.Namespace))
+}
+
+func (c *controller) updateNamespace(oldObj interface{}, newObj interface{}) {
+	oldNamespace := oldObj.(*v17.Namespace)
+	newNamespace := newObj.(*v17.Namespace)
+	if labels.Equals(oldNamespace.Labels, newNamespace.Labels) {
+		return
+	}
+	c.enqueueNamespace(newNamespace)
+}
+
+// enqueueNamespace requeues the services of namespace, whose labels may now
+// select or no longer select it.
+func (c *controller) enqueueNamespace(namespace *v17.Namespace) {
+	services, err := c.serviceLister.Services(namespace.Name).List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, service := range services {
+		key, err := cache.MetaNamespaceKeyFunc(service)
+		if err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		c.queue.Add(key)
+	}
+}
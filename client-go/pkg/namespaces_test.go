@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"testing"
+
+	v17 "k8s.io/api/core/v1"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespaceFilterAllows(t *testing.T) {
+	i := informers.NewSharedInformerFactory(k8sfake.NewSimpleClientset(), 0)
+	indexer := i.Core().V1().Namespaces().Informer().GetIndexer()
+	indexer.Add(&v17.Namespace{ObjectMeta: v16.ObjectMeta{Name: "opted-in", Labels: map[string]string{"ingress-manager": "enabled"}}})
+	indexer.Add(&v17.Namespace{ObjectMeta: v16.ObjectMeta{Name: "plain"}})
+	lister := i.Core().V1().Namespaces().Lister()
+	selector := labels.SelectorFromSet(labels.Set{"ingress-manager": "enabled"})
+
+	tests := []struct {
+		name      string
+		filter    NamespaceFilter
+		namespace string
+		want      bool
+	}{
+		{name: "no filter", namespace: "plain", want: true},
+		{name: "included", filter: NamespaceFilter{Include: []string{"a", "plain"}}, namespace: "plain", want: true},
+		{name: "not included", filter: NamespaceFilter{Include: []string{"a"}}, namespace: "plain"},
+		{name: "excluded", filter: NamespaceFilter{Exclude: []string{"kube-system"}}, namespace: "kube-system"},
+		{name: "exclude wins", filter: NamespaceFilter{Include: []string{"plain"}, Exclude: []string{"plain"}}, namespace: "plain"},
+		{name: "selected", filter: NamespaceFilter{Selector: selector}, namespace: "opted-in", want: true},
+		{name: "not selected", filter: NamespaceFilter{Selector: selector}, namespace: "plain"},
+		{name: "unknown namespace", filter: NamespaceFilter{Selector: selector}, namespace: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.allows(tt.namespace, lister)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceFilterTweakListOptions(t *testing.T) {
+	filter := NamespaceFilter{Exclude: []string{"kube-system", "kube-public"}}
+	options := v16.ListOptions{FieldSelector: "metadata.name=test"}
+	filter.TweakListOptions(&options)
+	want := "metadata.namespace!=kube-system,metadata.namespace!=kube-public,metadata.name=test"
+	if options.FieldSelector != want {
+		t.Errorf("got field selector %q, want %q", options.FieldSelector, want)
+	}
+}
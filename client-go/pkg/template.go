@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// annotationTemplate names a ConfigMap in the namespace of the service whose
+// templateKey holds the Go template of the ingress.
+const annotationTemplate = "ingress/template"
+
+// templateKey is the key of the ingress template in a template ConfigMap.
+const templateKey = "ingress.yaml"
+
+// templateIndex indexes services by the namespace/name of their template
+// ConfigMap.
+const templateIndex = "template"
+
+const (
+	// ReasonInvalidTemplate is the reason of the event recorded on a service
+	// whose ingress template can not be rendered.
+	ReasonInvalidTemplate = "InvalidTemplate"
+)
+
+// templateData is what an ingress template is executed against.
+type templateData struct {
+	// Service is the annotated service.
+	Service *v17.Service
+	// Host, Path, PathType, Port and ClassName are taken from the
+	// annotations, with the defaults filled in. Port is always a number.
+	Host      string
+	Path      string
+	PathType  string
+	Port      int32
+	ClassName string
+	// TLS is set by ingress/tls, TLSSecretName is the secret to use then.
+	TLS           bool
+	TLSSecretName string
+}
+
+// serviceTemplateIndexFunc indexes annotated services by the ConfigMap named
+// in their template annotation.
+func serviceTemplateIndexFunc(obj interface{}) ([]string, error) {
+	service, ok := obj.(*v17.Service)
+	if !ok {
+		return nil, nil
+	}
+	name, ok := service.Annotations[annotationTemplate]
+	if !ok {
+		return nil, nil
+	}
+	return []string{service.Namespace + "/" + name}, nil
+}
+
+// templateFor returns the ConfigMap holding the ingress template of service,
+// or nil to use the built-in ingress. A missing ConfigMap is an error, the
+// service is requeued when it shows up.
+func (c *controller) templateFor(service *v17.Service) (*v17.ConfigMap, error) {
+	if name, ok := service.Annotations[annotationTemplate]; ok && c.configMapLister != nil {
+		return c.configMapLister.ConfigMaps(service.Namespace).Get(name)
+	}
+	if c.defaultTemplate.Name == "" {
+		return nil, nil
+	}
+	return c.defaultTemplateLister.ConfigMaps(c.defaultTemplate.Namespace).Get(c.defaultTemplate.Name)
+}
+
+// desiredIngress returns the ingress service should have, built in or
+// rendered from its template. Template problems are reported as an event on
+// the service and return a nil ingress, retrying would not help.
+func (c *controller) desiredIngress(service *v17.Service, opts ingressOptions) (*v15.Ingress, error) {
+	configMap, err := c.templateFor(service)
+	if errors.IsNotFound(err) {
+		c.recorder.Eventf(service, v17.EventTypeWarning, ReasonInvalidTemplate, "template ConfigMap not found: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if configMap == nil {
+		return c.constructIngress(service, opts), nil
+	}
+	ingress, err := renderIngress(configMap, service, opts)
+	if err != nil {
+		c.recorder.Eventf(service, v17.EventTypeWarning, ReasonInvalidTemplate, "template ConfigMap %s/%s: %v", configMap.Namespace, configMap.Name, err)
+		return nil, nil
+	}
+	return ingress, nil
+}
+
+// renderedHostPath returns the host and path of the first rule of ingress,
+// which a template may have chosen differently from the annotations. What
+// the ingress leaves out is taken from opts.
+func renderedHostPath(ingress *v15.Ingress, opts ingressOptions) (string, string) {
+	if len(ingress.Spec.Rules) == 0 {
+		return opts.host, opts.path
+	}
+	rule := ingress.Spec.Rules[0]
+	host, path := rule.Host, opts.path
+	if host == "" {
+		host = opts.host
+	}
+	if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+		path = rule.HTTP.Paths[0].Path
+	}
+	return host, path
+}
+
+// renderIngress executes the template in configMap for service and checks
+// that the result is a single Ingress for service. The name and namespace
+// default to those of the service and the owner reference is always set.
+func renderIngress(configMap *v17.ConfigMap, service *v17.Service, opts ingressOptions) (*v15.Ingress, error) {
+	text, ok := configMap.Data[templateKey]
+	if !ok {
+		return nil, fmt.Errorf("missing key %q", templateKey)
+	}
+	tmpl, err := template.New(configMap.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	port, err := servicePortNumber(service, opts.port)
+	if err != nil {
+		return nil, err
+	}
+	data := templateData{
+		Service:       service,
+		Host:          opts.host,
+		Path:          opts.path,
+		PathType:      string(opts.pathType),
+		Port:          port,
+		TLS:           opts.tls,
+		TLSSecretName: opts.tlsSecretName,
+	}
+	if opts.className != nil {
+		data.ClassName = *opts.className
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	ingress := &v15.Ingress{}
+	if err := yaml.UnmarshalStrict(buf.Bytes(), ingress); err != nil {
+		return nil, fmt.Errorf("rendered template is not a valid Ingress: %v", err)
+	}
+	if gvk := ingress.GroupVersionKind(); gvk != v15.SchemeGroupVersion.WithKind("Ingress") {
+		return nil, fmt.Errorf("rendered template must be a networking.k8s.io/v1 Ingress, got %q %q", ingress.APIVersion, ingress.Kind)
+	}
+	if ingress.Namespace != "" && ingress.Namespace != service.Namespace {
+		return nil, fmt.Errorf("rendered Ingress must be in namespace %q, got %q", service.Namespace, ingress.Namespace)
+	}
+	if ingress.Name != "" && ingress.Name != service.Name {
+		return nil, fmt.Errorf("rendered Ingress must be named %q, got %q", service.Name, ingress.Name)
+	}
+	if len(ingress.OwnerReferences) > 0 {
+		return nil, fmt.Errorf("rendered Ingress must not set ownerReferences")
+	}
+	ingress.TypeMeta = v16.TypeMeta{}
+	ingress.Name = service.Name
+	ingress.Namespace = service.Namespace
+	ingress.OwnerReferences = []v16.OwnerReference{
+		*v16.NewControllerRef(service, schema.GroupVersionKind{Kind: "Service", Version: "v1", Group: ""}),
+	}
+	ingress.Status = v15.IngressStatus{}
+	return ingress, nil
+}
+
+func (c *controller) addConfigMap(obj interface{}) {
+	c.enqueueTemplateUsers(obj)
+}
+
+func (c *controller) updateConfigMap(oldObj interface{}, newObj interface{}) {
+	oldConfigMap := oldObj.(*v17.ConfigMap)
+	newConfigMap := newObj.(*v17.ConfigMap)
+	if oldConfigMap.ResourceVersion == newConfigMap.ResourceVersion {
+		return
+	}
+	c.enqueueTemplateUsers(newConfigMap)
+}
+
+func (c *controller) deleteConfigMap(obj interface{}) {
+	c.enqueueTemplateUsers(obj)
+}
+
+// enqueueTemplateUsers requeues the services rendered from the ConfigMap obj,
+// so that they are re-rendered.
+func (c *controller) enqueueTemplateUsers(obj interface{}) {
+	configMap, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+	if configMap.GetNamespace() == c.defaultTemplate.Namespace && configMap.GetName() == c.defaultTemplate.Name {
+		services, err := c.serviceLister.List(labels.Everything())
+		if err != nil {
+			runtime.HandleError(err)
+			return
+		}
+		for _, service := range services {
+			_, annotated := service.Annotations[annotationHTTP]
+			_, ownTemplate := service.Annotations[annotationTemplate]
+			if annotated && (!ownTemplate || c.configMapLister == nil) {
+				c.enqueue(service)
+			}
+		}
+		return
+	}
+
+	key := types.NamespacedName{Namespace: configMap.GetNamespace(), Name: configMap.GetName()}.String()
+	objs, err := c.serviceIndexer.ByIndex(templateIndex, key)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		c.enqueue(obj)
+	}
+}
@@ -0,0 +1,284 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v17 "k8s.io/api/core/v1"
+	v15 "k8s.io/api/networking/v1"
+	v16 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/diff"
+	core "k8s.io/client-go/testing"
+)
+
+const testTemplate = `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  annotations:
+    nginx.ingress.kubernetes.io/limit-rps: "10"
+spec:
+  rules:
+  - host: {{.Host}}
+    http:
+      paths:
+      - path: {{.Path}}
+        pathType: {{.PathType}}
+        backend:
+          service:
+            name: {{.Service.Name}}
+            port:
+              number: {{.Port}}
+`
+
+func newTemplate(name, text string) *v17.ConfigMap {
+	return &v17.ConfigMap{
+		ObjectMeta: v16.ObjectMeta{Name: name, Namespace: v16.NamespaceDefault},
+		Data:       map[string]string{templateKey: text},
+	}
+}
+
+// newTemplateIngress returns the ingress testTemplate renders for service.
+func newTemplateIngress(service *v17.Service, host string) *v15.Ingress {
+	ing := newIngress(service, host)
+	ing.Annotations = map[string]string{"nginx.ingress.kubernetes.io/limit-rps": "10"}
+	ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = v15.ServiceBackendPort{Number: 8080}
+	return ing
+}
+
+func TestRenderIngress(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			text: testTemplate,
+		},
+		{
+			name:    "wrong kind",
+			text:    strings.Replace(testTemplate, "kind: Ingress", "kind: Service", 1),
+			wantErr: "must be a networking.k8s.io/v1 Ingress",
+		},
+		{
+			name:    "other namespace",
+			text:    strings.Replace(testTemplate, "metadata:\n", "metadata:\n  namespace: kube-system\n", 1),
+			wantErr: "must be in namespace",
+		},
+		{
+			name:    "other name",
+			text:    strings.Replace(testTemplate, "metadata:\n", "metadata:\n  name: other\n", 1),
+			wantErr: "must be named",
+		},
+		{
+			name:    "unknown field",
+			text:    strings.Replace(testTemplate, "spec:\n", "spec:\n  replicas: 2\n", 1),
+			wantErr: "not a valid Ingress",
+		},
+		{
+			name:    "missing field",
+			text:    "host: {{.Hostname}}",
+			wantErr: "can't evaluate field Hostname",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+			opts, err := parseAnnotations(s, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderIngress(newTemplate("tmpl", test.text), s, opts)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := newTemplateIngress(s, "test.example.com")
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected ingress:\n%s", diff.ObjectGoPrintSideBySide(want, got))
+			}
+		})
+	}
+}
+
+func TestTemplateIngress(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTemplate: "tmpl"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.configMapLister = append(f.configMapLister, newTemplate("tmpl", testTemplate))
+	f.objects = append(f.objects, s)
+
+	f.expectCreateIngressAction(newTemplateIngress(s, "test.example.com"))
+	f.run("default/test")
+}
+
+func TestTemplateHostTLS(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	// the template chooses the host, the service has no ingress/host
+	text := strings.Replace(testTemplate, "{{.Host}}", "{{.Service.Name}}.templated.example.com", 1)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationTLS: "true", annotationTemplate: "tmpl"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.configMapLister = append(f.configMapLister, newTemplate("tmpl", text))
+	f.objects = append(f.objects, s)
+
+	f.expectCreateSecretAction(s.Namespace, "test-tls")
+	f.expectCreateIngressAction(newTemplateIngress(s, "test.templated.example.com"))
+	f.run("default/test")
+
+	secret := f.client.Actions()[1].(core.CreateAction).GetObject().(*v17.Secret)
+	if renewAt, err := certRenewalTime(secret, "test.templated.example.com"); err != nil || renewAt.IsZero() {
+		t.Errorf("certificate is not for the templated host: %v", err)
+	}
+}
+
+func TestTemplateHostConflict(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	// the template ignores the annotated host
+	text := strings.Replace(testTemplate, "{{.Host}}", "shared.example.com", 1)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTemplate: "tmpl"})
+	other := newService("other", nil)
+	other.Namespace = "other"
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, newIngress(other, "shared.example.com"))
+	f.configMapLister = append(f.configMapLister, newTemplate("tmpl", text))
+	f.objects = append(f.objects, s)
+
+	f.expectConflictPatchAction(s, `host "shared.example.com" and path "/" are used by ingress other/other`)
+	f.run("default/test")
+}
+
+func TestTemplatedServicesOldestWins(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	// both templates render the same host, the services have no ingress/host
+	text := strings.Replace(testTemplate, "{{.Host}}", "shared.example.com", 1)
+	annotations := map[string]string{annotationHTTP: "true", annotationTemplate: "tmpl"}
+	older := newService("older", annotations)
+	older.CreationTimestamp = v16.NewTime(time.Now().Add(-time.Hour))
+	newer := newService("newer", annotations)
+	newer.CreationTimestamp = v16.NewTime(time.Now())
+	// the newer service got its ingress first
+	ing := newTemplateIngress(newer, "shared.example.com")
+	f.serviceLister = append(f.serviceLister, older, newer)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.configMapLister = append(f.configMapLister, newTemplate("tmpl", text))
+	f.objects = append(f.objects, older, newer, ing)
+
+	f.expectConflictPatchAction(newer, `host "shared.example.com" and path "/" are used by service default/older`)
+	f.expectDeleteIngressAction(ing)
+	f.run("default/newer")
+}
+
+func TestTemplateHostNoFalseConflict(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	// the older service is annotated with the host, but its template
+	// renders another one
+	text := strings.Replace(testTemplate, "{{.Host}}", "other.example.com", 1)
+	templated := newService("templated", map[string]string{annotationHTTP: "true", annotationHost: "shared.example.com", annotationTemplate: "tmpl"})
+	templated.CreationTimestamp = v16.NewTime(time.Now().Add(-time.Hour))
+	plain := newService("plain", map[string]string{annotationHTTP: "true", annotationHost: "shared.example.com"})
+	plain.CreationTimestamp = v16.NewTime(time.Now())
+	f.serviceLister = append(f.serviceLister, templated, plain)
+	f.configMapLister = append(f.configMapLister, newTemplate("tmpl", text))
+	f.objects = append(f.objects, templated, plain)
+
+	f.expectCreateIngressAction(newIngress(plain, "shared.example.com"))
+	f.run("default/plain")
+}
+
+func TestTemplateAnnotationDisabled(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com", annotationTemplate: "tmpl"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	// without a ConfigMap informer the annotation is ignored
+	f.expectCreateIngressAction(newIngress(s, "test.example.com"))
+	f.run("default/test")
+}
+
+func TestTLSWithoutHost(t *testing.T) {
+	f := newFixture(t)
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationTLS: "true"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.run("default/test")
+
+	select {
+	case event := <-f.recorder.Events:
+		if !strings.HasPrefix(event, v17.EventTypeWarning+" "+ReasonInvalidAnnotation) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for tls without a host")
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	f.config.DefaultTemplate = types.NamespacedName{Namespace: v16.NamespaceDefault, Name: "default-tmpl"}
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationHost: "test.example.com"})
+	ing := newIngress(s, "test.example.com")
+	f.serviceLister = append(f.serviceLister, s)
+	f.ingressLister = append(f.ingressLister, ing)
+	f.configMapLister = append(f.configMapLister, newTemplate("default-tmpl", testTemplate))
+	f.objects = append(f.objects, s, ing)
+
+	f.expectUpdateIngressAction(newTemplateIngress(s, "test.example.com"))
+	f.run("default/test")
+}
+
+func TestMissingTemplate(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	s := newService("test", map[string]string{annotationHTTP: "true", annotationTemplate: "missing"})
+	f.serviceLister = append(f.serviceLister, s)
+	f.objects = append(f.objects, s)
+
+	f.run("default/test")
+
+	select {
+	case event := <-f.recorder.Events:
+		if !strings.HasPrefix(event, v17.EventTypeWarning+" "+ReasonInvalidTemplate) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the missing template")
+	}
+}
+
+func TestTemplateChangeEnqueuesUsers(t *testing.T) {
+	f := newFixture(t)
+	f.templates = true
+	user := newService("user", map[string]string{annotationHTTP: "true", annotationTemplate: "tmpl"})
+	other := newService("other", map[string]string{annotationHTTP: "true"})
+	f.serviceLister = append(f.serviceLister, user, other)
+
+	c, _ := f.newController()
+	old := newTemplate("tmpl", testTemplate)
+	old.ResourceVersion = "1"
+	updated := old.DeepCopy()
+	updated.ResourceVersion = "2"
+	c.updateConfigMap(old, updated)
+
+	if c.queue.Len() != 1 {
+		t.Fatalf("queue has %d items, want 1", c.queue.Len())
+	}
+	if item, _ := c.queue.Get(); item != "default/user" {
+		t.Errorf("enqueued %v, want default/user", item)
+	}
+}
@@ -0,0 +1,125 @@
+// crdwatch streams the changes of any resource, custom or built in, as JSON
+// lines. It uses the dynamic client, so it needs no generated code:
+//
+//	crdwatch --resource=foos.v1.crd.example.com -n default
+//	crdwatch --kind=Foo.v1.crd.jun.com -l app=web
+//
+// Adds and deletes carry the whole object, updates the changed fields.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func main() {
+	var (
+		kubeconfig    string
+		kubeContext   string
+		resource      string
+		kind          string
+		namespace     string
+		allNamespaces bool
+		labelSelector string
+		fieldSelector string
+	)
+	fs := pflag.NewFlagSet("crdwatch", pflag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&kubeContext, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVar(&resource, "resource", "", "Resource to watch as resource[.version][.group], e.g. foos.v1.crd.example.com.")
+	fs.StringVar(&kind, "kind", "", "Kind to watch as Kind[.version][.group], e.g. Foo.v1.crd.example.com. The resource is discovered.")
+	fs.StringVarP(&namespace, "namespace", "n", "", "Namespace to watch. Defaults to the namespace of the current context.")
+	fs.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Watch all namespaces.")
+	fs.StringVarP(&labelSelector, "selector", "l", "", "Label selector, e.g. app=web.")
+	fs.StringVar(&fieldSelector, "field-selector", "", "Field selector, e.g. metadata.name=example-foo.")
+	fs.Parse(os.Args[1:])
+
+	if (resource == "") == (kind == "") {
+		fmt.Fprintln(os.Stderr, "crdwatch: exactly one of --resource and --kind is required")
+		os.Exit(2)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	if err := run(clientConfig, options{
+		resource:      resource,
+		kind:          kind,
+		namespace:     namespace,
+		allNamespaces: allNamespaces,
+		labelSelector: labelSelector,
+		fieldSelector: fieldSelector,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "crdwatch: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// options are the command line options of crdwatch.
+type options struct {
+	resource      string
+	kind          string
+	namespace     string
+	allNamespaces bool
+	labelSelector string
+	fieldSelector string
+}
+
+func run(clientConfig clientcmd.ClientConfig, opts options) error {
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	mapping, err := resolve(mapper, opts.resource, opts.kind)
+	if err != nil {
+		return err
+	}
+
+	namespace := metav1.NamespaceAll
+	if mapping.Scope.Name() == "namespace" && !opts.allNamespaces {
+		namespace = opts.namespace
+		if namespace == "" {
+			if namespace, _, err = clientConfig.Namespace(); err != nil {
+				return err
+			}
+		}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, namespace, func(options *metav1.ListOptions) {
+		options.LabelSelector = opts.labelSelector
+		options.FieldSelector = opts.fieldSelector
+	})
+	informer := factory.ForResource(mapping.Resource).Informer()
+	informer.AddEventHandler(newPrinter(os.Stdout).handlers())
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("can't list %s", mapping.Resource)
+	}
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// event is one line of output.
+type event struct {
+	Type            watch.EventType `json:"type"`
+	Time            string          `json:"time"`
+	Kind            string          `json:"kind"`
+	Namespace       string          `json:"namespace,omitempty"`
+	Name            string          `json:"name"`
+	ResourceVersion string          `json:"resourceVersion,omitempty"`
+	// Object is set for added and deleted objects.
+	Object map[string]interface{} `json:"object,omitempty"`
+	// Changes is set for modified objects.
+	Changes []change `json:"changes,omitempty"`
+}
+
+// change is a changed field. Old is missing for added fields, New for
+// removed ones.
+type change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ignoredPaths change with every update and are left out of the changes.
+var ignoredPaths = map[string]bool{
+	"metadata.resourceVersion": true,
+	"metadata.managedFields":   true,
+}
+
+// printer writes the informer events to out as JSON lines. The handlers of
+// an informer are called one at a time, so it needs no locking.
+type printer struct {
+	encoder *json.Encoder
+	now     func() time.Time
+}
+
+func newPrinter(out io.Writer) *printer {
+	return &printer{encoder: json.NewEncoder(out), now: time.Now}
+}
+
+func (p *printer) handlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.print(watch.Added, obj.(*unstructured.Unstructured), nil)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldU := oldObj.(*unstructured.Unstructured)
+			newU := newObj.(*unstructured.Unstructured)
+			if oldU.GetResourceVersion() == newU.GetResourceVersion() {
+				return
+			}
+			p.print(watch.Modified, newU, diff(oldU.Object, newU.Object))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				p.print(watch.Deleted, u, nil)
+			}
+		},
+	}
+}
+
+func (p *printer) print(eventType watch.EventType, obj *unstructured.Unstructured, changes []change) {
+	e := event{
+		Type:            eventType,
+		Time:            p.now().UTC().Format(time.RFC3339),
+		Kind:            obj.GetKind(),
+		Namespace:       obj.GetNamespace(),
+		Name:            obj.GetName(),
+		ResourceVersion: obj.GetResourceVersion(),
+		Changes:         changes,
+	}
+	if eventType != watch.Modified {
+		e.Object = obj.Object
+	}
+	if err := p.encoder.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "crdwatch: %v\n", err)
+	}
+}
+
+// diff returns the fields which differ between oldObj and newObj, sorted by
+// path. Lists of the same length are compared item by item, other lists as
+// a whole.
+func diff(oldObj, newObj map[string]interface{}) []change {
+	var changes []change
+	diffValue("", oldObj, newObj, &changes)
+	return changes
+}
+
+func diffValue(path string, oldValue, newValue interface{}, changes *[]change) {
+	if ignoredPaths[path] || reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := map[string]bool{}
+		for key := range oldMap {
+			keys[key] = true
+		}
+		for key := range newMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diffValue(joinPath(path, key), oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList && len(oldList) == len(newList) {
+		for i := range oldList {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i], changes)
+		}
+		return
+	}
+	*changes = append(*changes, change{Path: path, Old: oldValue, New: newValue})
+}
+
+// joinPath appends key to path, keys with dots are quoted like in jq.
+func joinPath(path, key string) string {
+	if strings.Contains(key, ".") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
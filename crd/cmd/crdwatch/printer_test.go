@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[string]interface{}
+		want     []change
+	}{
+		{
+			name: "equal",
+			old:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}},
+			new:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}},
+		},
+		{
+			name: "changed, added and removed fields",
+			old:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1), "paused": true}},
+			new:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2), "image": "nginx"}},
+			want: []change{
+				{Path: "spec.image", New: "nginx"},
+				{Path: "spec.paused", Old: true},
+				{Path: "spec.replicas", Old: int64(1), New: int64(2)},
+			},
+		},
+		{
+			name: "list items",
+			old:  map[string]interface{}{"args": []interface{}{"a", "b"}},
+			new:  map[string]interface{}{"args": []interface{}{"a", "c"}},
+			want: []change{{Path: "args[1]", Old: "b", New: "c"}},
+		},
+		{
+			name: "list length",
+			old:  map[string]interface{}{"args": []interface{}{"a"}},
+			new:  map[string]interface{}{"args": []interface{}{"a", "b"}},
+			want: []change{{Path: "args", Old: []interface{}{"a"}, New: []interface{}{"a", "b"}}},
+		},
+		{
+			name: "ignored and quoted paths",
+			old: map[string]interface{}{"metadata": map[string]interface{}{
+				"resourceVersion": "1",
+				"labels":          map[string]interface{}{"app.kubernetes.io/name": "web"},
+			}},
+			new: map[string]interface{}{"metadata": map[string]interface{}{
+				"resourceVersion": "2",
+				"labels":          map[string]interface{}{"app.kubernetes.io/name": "api"},
+			}},
+			want: []change{{Path: `metadata.labels."app.kubernetes.io/name"`, Old: "web", New: "api"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diff(test.old, test.new); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func newFoo(resourceVersion string, replicas int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "crd.example.com/v1",
+		"kind":       "Foo",
+		"metadata": map[string]interface{}{
+			"name":            "example-foo",
+			"namespace":       "default",
+			"resourceVersion": resourceVersion,
+		},
+		"spec": map[string]interface{}{"replicas": replicas},
+	}}
+}
+
+func TestPrinter(t *testing.T) {
+	var out bytes.Buffer
+	p := newPrinter(&out)
+	p.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	handlers := p.handlers()
+
+	handlers.OnAdd(newFoo("1", 1))
+	handlers.OnUpdate(newFoo("1", 1), newFoo("1", 1))
+	handlers.OnUpdate(newFoo("1", 1), newFoo("2", 2))
+	handlers.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/example-foo", Obj: newFoo("2", 2)})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`{"type":"ADDED","time":"2023-01-02T03:04:05Z","kind":"Foo","namespace":"default","name":"example-foo","resourceVersion":"1","object":{"apiVersion":"crd.example.com/v1","kind":"Foo","metadata":{"name":"example-foo","namespace":"default","resourceVersion":"1"},"spec":{"replicas":1}}}`,
+		`{"type":"MODIFIED","time":"2023-01-02T03:04:05Z","kind":"Foo","namespace":"default","name":"example-foo","resourceVersion":"2","changes":[{"path":"spec.replicas","old":1,"new":2}]}`,
+		`{"type":"DELETED","time":"2023-01-02T03:04:05Z","kind":"Foo","namespace":"default","name":"example-foo","resourceVersion":"2","object":{"apiVersion":"crd.example.com/v1","kind":"Foo","metadata":{"name":"example-foo","namespace":"default","resourceVersion":"2"},"spec":{"replicas":2}}}`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("invalid JSON line %s", line)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resolve finds the REST mapping of either resource, as
+// resource[.version][.group], or kind, as Kind[.version][.group]. Without a
+// version the preferred one is used.
+func resolve(mapper meta.RESTMapper, resource, kind string) (*meta.RESTMapping, error) {
+	if resource != "" {
+		gvk, err := kindForResource(mapper, resource)
+		if err != nil {
+			return nil, err
+		}
+		return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+
+	gvk, gk := schema.ParseKindArg(kind)
+	if gvk != nil {
+		// Foo.v1.crd.example.com may also be the group v1.crd.example.com
+		if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			return mapping, nil
+		}
+	}
+	mapping, err := mapper.RESTMapping(gk)
+	if err != nil {
+		return nil, fmt.Errorf("kind %q: %w", kind, err)
+	}
+	return mapping, nil
+}
+
+func kindForResource(mapper meta.RESTMapper, resource string) (schema.GroupVersionKind, error) {
+	gvr, gr := schema.ParseResourceArg(resource)
+	if gvr != nil {
+		if gvk, err := mapper.KindFor(*gvr); err == nil {
+			return gvk, nil
+		}
+	}
+	gvk, err := mapper.KindFor(gr.WithVersion(""))
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("resource %q: %w", resource, err)
+	}
+	return gvk, nil
+}
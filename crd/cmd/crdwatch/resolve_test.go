@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResolve(t *testing.T) {
+	// the default versions stand in for the preferred versions from discovery
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		{Group: "crd.example.com", Version: "v1"},
+		{Group: "crd.jun.com", Version: "v1"},
+		{Version: "v1"},
+	})
+	mapper.Add(schema.GroupVersionKind{Group: "crd.example.com", Version: "v1", Kind: "Foo"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "crd.jun.com", Version: "v1", Kind: "Foo"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+
+	tests := []struct {
+		resource, kind string
+		want           schema.GroupVersionResource
+		wantErr        bool
+	}{
+		{resource: "foos.v1.crd.example.com", want: schema.GroupVersionResource{Group: "crd.example.com", Version: "v1", Resource: "foos"}},
+		{resource: "foos.crd.jun.com", want: schema.GroupVersionResource{Group: "crd.jun.com", Version: "v1", Resource: "foos"}},
+		{resource: "namespaces", want: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}},
+		{kind: "Foo.v1.crd.example.com", want: schema.GroupVersionResource{Group: "crd.example.com", Version: "v1", Resource: "foos"}},
+		{kind: "Foo.crd.jun.com", want: schema.GroupVersionResource{Group: "crd.jun.com", Version: "v1", Resource: "foos"}},
+		{kind: "Namespace", want: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}},
+		{resource: "bars", wantErr: true},
+		{kind: "Bar", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.resource+test.kind, func(t *testing.T) {
+			mapping, err := resolve(mapper, test.resource, test.kind)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", mapping.Resource)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mapping.Resource != test.want {
+				t.Errorf("got %v, want %v", mapping.Resource, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	crdv1 "github.com/2456868764/operator/crd/pkg/apis/crd.example.com/v1"
+	clientset "github.com/2456868764/operator/crd/pkg/generated/clientset/versioned"
+	fooscheme "github.com/2456868764/operator/crd/pkg/generated/clientset/versioned/scheme"
+	informers "github.com/2456868764/operator/crd/pkg/generated/informers/externalversions/crd.example.com/v1"
+	listers "github.com/2456868764/operator/crd/pkg/generated/listers/crd.example.com/v1"
+)
+
+const controllerAgentName = "foo-controller"
+
+const (
+	// SuccessSynced is used as part of the Event 'reason' when a Foo is synced
+	SuccessSynced = "Synced"
+	// ErrResourceExists is used as part of the Event 'reason' when a Foo fails
+	// to sync due to a Deployment of the same name already existing.
+	ErrResourceExists = "ErrResourceExists"
+
+	// MessageResourceExists is the message used for Events when a resource
+	// fails to sync due to a Deployment already existing
+	MessageResourceExists = "Resource %q already exists and is not managed by Foo"
+	// MessageResourceSynced is the message used for an Event fired when a Foo
+	// is synced successfully
+	MessageResourceSynced = "Foo synced successfully"
+)
+
+// Controller reconciles each Foo into a Deployment named spec.deploymentName
+// and reports the available replicas of that Deployment in the Foo status.
+type Controller struct {
+	// kubeclientset is a standard kubernetes clientset
+	kubeclientset kubernetes.Interface
+	// fooclientset is a clientset for the crd.example.com API group
+	fooclientset clientset.Interface
+
+	deploymentsLister appslisters.DeploymentLister
+	deploymentsSynced cache.InformerSynced
+	foosLister        listers.FooLister
+	foosSynced        cache.InformerSynced
+
+	// workqueue holds the namespace/name keys of the Foos to sync, a key is
+	// never synced by two workers at the same time.
+	workqueue workqueue.RateLimitingInterface
+	// recorder records Events on the Foos.
+	recorder record.EventRecorder
+}
+
+// NewController returns a new Foo controller
+func NewController(
+	kubeclientset kubernetes.Interface,
+	fooclientset clientset.Interface,
+	deploymentInformer appsinformers.DeploymentInformer,
+	fooInformer informers.FooInformer) *Controller {
+
+	// Add the Foo types to the default Kubernetes Scheme so Events can be
+	// recorded for them.
+	utilruntime.Must(fooscheme.AddToScheme(scheme.Scheme))
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+
+	controller := &Controller{
+		kubeclientset:     kubeclientset,
+		fooclientset:      fooclientset,
+		deploymentsLister: deploymentInformer.Lister(),
+		deploymentsSynced: deploymentInformer.Informer().HasSynced,
+		foosLister:        fooInformer.Lister(),
+		foosSynced:        fooInformer.Informer().HasSynced,
+		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Foos"),
+		recorder:          recorder,
+	}
+
+	klog.Info("Setting up event handlers")
+	fooInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueFoo,
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueFoo(new)
+		},
+	})
+	// A Deployment owned by a Foo requeues its Foo, so that changes to the
+	// Deployment are reverted and its status is copied to the Foo.
+	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newDepl := new.(*appsv1.Deployment)
+			oldDepl := old.(*appsv1.Deployment)
+			if newDepl.ResourceVersion == oldDepl.ResourceVersion {
+				// Periodic resync will send update events for all known Deployments.
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+
+	return controller
+}
+
+// Run waits for the informer caches to sync and starts workers workers. It
+// blocks until ctx is canceled, then shuts down the workqueue and returns.
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	klog.Info("Starting Foo controller")
+	klog.Info("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.foosSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	klog.InfoS("Starting workers", "count", workers)
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+
+	klog.Info("Started workers")
+	<-ctx.Done()
+	klog.Info("Shutting down workers")
+	return nil
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+// processNextWorkItem syncs the next key of the workqueue. Failed keys are
+// requeued with back-off. It returns false once the workqueue is shut down.
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer c.workqueue.Done(obj)
+		key, ok := obj.(string)
+		if !ok {
+			// An invalid item would fail forever, drop it.
+			c.workqueue.Forget(obj)
+			return fmt.Errorf("expected string in workqueue but got %#v", obj)
+		}
+		if err := c.syncHandler(ctx, key); err != nil {
+			c.workqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing %q: %w, requeuing", key, err)
+		}
+		c.workqueue.Forget(obj)
+		klog.V(2).InfoS("Successfully synced", "key", key)
+		return nil
+	}(obj)
+
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+	return true
+}
+
+// syncHandler makes the Deployment of the Foo with the given key match its
+// spec and then updates the Foo status from the Deployment.
+func (c *Controller) syncHandler(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	foo, err := c.foosLister.Foos(namespace).Get(name)
+	if err != nil {
+		// The Foo is gone, its Deployment is garbage collected.
+		if errors.IsNotFound(err) {
+			utilruntime.HandleError(fmt.Errorf("foo '%s' in work queue no longer exists", key))
+			return nil
+		}
+		return err
+	}
+
+	deploymentName := foo.Spec.DeploymentName
+	if deploymentName == "" {
+		// Retrying would not help until the Foo is changed, which requeues it.
+		utilruntime.HandleError(fmt.Errorf("%s: deployment name must be specified", key))
+		return nil
+	}
+
+	deployment, err := c.deploymentsLister.Deployments(foo.Namespace).Get(deploymentName)
+	if errors.IsNotFound(err) {
+		deployment, err = c.kubeclientset.AppsV1().Deployments(foo.Namespace).Create(ctx, newDeployment(foo), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	// A Deployment of that name which is not ours is reported and left alone.
+	if !metav1.IsControlledBy(deployment, foo) {
+		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
+		c.recorder.Event(foo, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return fmt.Errorf("%s", msg)
+	}
+
+	if foo.Spec.Replicas != nil && (deployment.Spec.Replicas == nil || *foo.Spec.Replicas != *deployment.Spec.Replicas) {
+		klog.V(4).InfoS("Update deployment resource", "foo", klog.KObj(foo), "replicas", *foo.Spec.Replicas)
+		deploymentCopy := deployment.DeepCopy()
+		deploymentCopy.Spec.Replicas = foo.Spec.Replicas
+		deployment, err = c.kubeclientset.AppsV1().Deployments(foo.Namespace).Update(ctx, deploymentCopy, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.updateFooStatus(ctx, foo, deployment); err != nil {
+		return err
+	}
+
+	c.recorder.Event(foo, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	return nil
+}
+
+// updateFooStatus copies the replicas, available replicas and pod selector
+// of deployment to the status of foo through the status subresource, if they
+// differ. The replicas and selector back the scale subresource of Foo.
+func (c *Controller) updateFooStatus(ctx context.Context, foo *crdv1.Foo, deployment *appsv1.Deployment) error {
+	selector, err := deploymentSelector(deployment)
+	if err != nil {
+		return err
+	}
+	if foo.Status.AvailableReplicas == deployment.Status.AvailableReplicas &&
+		foo.Status.Replicas == deployment.Status.Replicas &&
+		foo.Status.Selector == selector {
+		return nil
+	}
+	// Objects from the lister are shared with the cache, never modify them.
+	fooCopy := foo.DeepCopy()
+	fooCopy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	fooCopy.Status.Replicas = deployment.Status.Replicas
+	fooCopy.Status.Selector = selector
+	_, err = c.fooclientset.CrdV1().Foos(foo.Namespace).UpdateStatus(ctx, fooCopy, metav1.UpdateOptions{})
+	return err
+}
+
+// deploymentSelector returns the pod selector of deployment in the string
+// form the scale subresource expects.
+func deploymentSelector(deployment *appsv1.Deployment) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector of deployment %s/%s: %v", deployment.Namespace, deployment.Name, err)
+	}
+	return selector.String(), nil
+}
+
+// enqueueFoo puts the namespace/name key of a Foo onto the workqueue.
+func (c *Controller) enqueueFoo(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.workqueue.Add(key)
+}
+
+// handleObject enqueues the Foo controlling obj, if any. obj may be a
+// tombstone of a deleted object.
+func (c *Controller) handleObject(obj interface{}) {
+	var object metav1.Object
+	var ok bool
+	if object, ok = obj.(metav1.Object); !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		object, ok = tombstone.Obj.(metav1.Object)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+		klog.V(4).InfoS("Recovered deleted object", "resourceName", object.GetName())
+	}
+	ownerRef := metav1.GetControllerOf(object)
+	// crd.jun.com Foos are handled by the JunController
+	if ownerRef == nil || ownerRef.APIVersion != crdv1.SchemeGroupVersion.String() || ownerRef.Kind != "Foo" {
+		return
+	}
+	foo, err := c.foosLister.Foos(object.GetNamespace()).Get(ownerRef.Name)
+	if err != nil {
+		klog.V(4).InfoS("Ignore orphaned object", "object", klog.KObj(object), "foo", ownerRef.Name)
+		return
+	}
+	c.enqueueFoo(foo)
+}
+
+// newDeployment returns the Deployment of foo, controlled by foo so that
+// handleObject finds it and it is garbage collected with foo.
+func newDeployment(foo *crdv1.Foo) *appsv1.Deployment {
+	labels := map[string]string{
+		"app":        "nginx",
+		"controller": foo.Name,
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      foo.Spec.DeploymentName,
+			Namespace: foo.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(foo, crdv1.SchemeGroupVersion.WithKind("Foo")),
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: foo.Spec.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: "nginx:latest",
+						},
+					},
+				},
+			},
+		},
+	}
+}
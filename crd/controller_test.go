@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/diff"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	crdv1 "github.com/2456868764/operator/crd/pkg/apis/crd.example.com/v1"
+	"github.com/2456868764/operator/crd/pkg/generated/clientset/versioned/fake"
+	informers "github.com/2456868764/operator/crd/pkg/generated/informers/externalversions"
+)
+
+var alwaysReady = func() bool { return true }
+
+type fixture struct {
+	t *testing.T
+
+	client     *fake.Clientset
+	kubeclient *k8sfake.Clientset
+	// Objects to put in the store.
+	fooLister        []*crdv1.Foo
+	deploymentLister []*apps.Deployment
+	// Actions expected to happen on the client.
+	kubeactions []core.Action
+	actions     []core.Action
+	// Objects from here preloaded into NewSimpleClientset.
+	kubeobjects []runtime.Object
+	objects     []runtime.Object
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{}
+	f.t = t
+	f.objects = []runtime.Object{}
+	f.kubeobjects = []runtime.Object{}
+	return f
+}
+
+func newFoo(name string, replicas *int32) *crdv1.Foo {
+	return &crdv1.Foo{
+		TypeMeta: metav1.TypeMeta{APIVersion: crdv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: crdv1.FooSpec{
+			DeploymentName: name + "-deployment",
+			Replicas:       replicas,
+		},
+	}
+}
+
+func (f *fixture) newController() (*Controller, informers.SharedInformerFactory, kubeinformers.SharedInformerFactory) {
+	f.client = fake.NewSimpleClientset(f.objects...)
+	f.kubeclient = k8sfake.NewSimpleClientset(f.kubeobjects...)
+
+	i := informers.NewSharedInformerFactory(f.client, 0)
+	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, 0)
+
+	c := NewController(f.kubeclient, f.client, k8sI.Apps().V1().Deployments(), i.Crd().V1().Foos())
+	c.foosSynced = alwaysReady
+	c.deploymentsSynced = alwaysReady
+	c.recorder = &record.FakeRecorder{}
+
+	for _, foo := range f.fooLister {
+		i.Crd().V1().Foos().Informer().GetIndexer().Add(foo)
+	}
+	for _, d := range f.deploymentLister {
+		k8sI.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
+	}
+	return c, i, k8sI
+}
+
+func (f *fixture) run(fooName string) {
+	f.runController(fooName, false)
+}
+
+func (f *fixture) runExpectError(fooName string) {
+	f.runController(fooName, true)
+}
+
+func (f *fixture) runController(fooName string, expectError bool) {
+	c, _, _ := f.newController()
+
+	err := c.syncHandler(context.Background(), fooName)
+	if !expectError && err != nil {
+		f.t.Errorf("error syncing foo: %v", err)
+	} else if expectError && err == nil {
+		f.t.Error("expected error syncing foo, got nil")
+	}
+
+	checkActions(f.t, f.actions, f.client.Actions())
+	checkActions(f.t, f.kubeactions, f.kubeclient.Actions())
+}
+
+func checkActions(t *testing.T, expected, actual []core.Action) {
+	for i, action := range actual {
+		if len(expected) < i+1 {
+			t.Errorf("%d unexpected actions: %+v", len(actual)-len(expected), actual[i:])
+			break
+		}
+		checkAction(expected[i], action, t)
+	}
+	if len(expected) > len(actual) {
+		t.Errorf("%d additional expected actions:%+v", len(expected)-len(actual), expected[len(actual):])
+	}
+}
+
+// checkAction verifies that expected and actual actions are equal and both have
+// same attached resources
+func checkAction(expected, actual core.Action, t *testing.T) {
+	if !(expected.Matches(actual.GetVerb(), actual.GetResource().Resource) && actual.GetSubresource() == expected.GetSubresource()) {
+		t.Errorf("Expected\n\t%#v\ngot\n\t%#v", expected, actual)
+		return
+	}
+
+	if reflect.TypeOf(actual) != reflect.TypeOf(expected) {
+		t.Errorf("Action has wrong type. Expected: %t. Got: %t", expected, actual)
+		return
+	}
+
+	switch a := actual.(type) {
+	case core.CreateActionImpl:
+		e, _ := expected.(core.CreateActionImpl)
+		if !reflect.DeepEqual(e.GetObject(), a.GetObject()) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(e.GetObject(), a.GetObject()))
+		}
+	case core.UpdateActionImpl:
+		e, _ := expected.(core.UpdateActionImpl)
+		if !reflect.DeepEqual(e.GetObject(), a.GetObject()) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(e.GetObject(), a.GetObject()))
+		}
+	case core.DeleteActionImpl:
+		e, _ := expected.(core.DeleteActionImpl)
+		if e.GetName() != a.GetName() {
+			t.Errorf("Action %s %s has wrong name, expected %s, got %s",
+				a.GetVerb(), a.GetResource().Resource, e.GetName(), a.GetName())
+		}
+	default:
+		t.Errorf("Uncaptured Action %s %s, you should explicitly add a case to capture it",
+			actual.GetVerb(), actual.GetResource().Resource)
+	}
+}
+
+func (f *fixture) expectCreateDeploymentAction(d *apps.Deployment) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+}
+
+func (f *fixture) expectUpdateDeploymentAction(d *apps.Deployment) {
+	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+}
+
+func (f *fixture) expectUpdateFooStatusAction(foo *crdv1.Foo) {
+	f.actions = append(f.actions, core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "foos"}, "status", foo.Namespace, foo))
+}
+
+func getKey(foo *crdv1.Foo, t *testing.T) string {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(foo)
+	if err != nil {
+		t.Errorf("Unexpected error getting key for foo %v: %v", foo.Name, err)
+		return ""
+	}
+	return key
+}
+
+func TestCreatesDeployment(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+
+	f.expectCreateDeploymentAction(newDeployment(foo))
+	expFoo := foo.DeepCopy()
+	expFoo.Status.Selector = "app=nginx,controller=test"
+	f.expectUpdateFooStatusAction(expFoo)
+	f.run(getKey(foo, t))
+}
+
+func TestDoNothing(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	foo.Status.Selector = "app=nginx,controller=test"
+	d := newDeployment(foo)
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.run(getKey(foo, t))
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	foo.Status.Selector = "app=nginx,controller=test"
+	d := newDeployment(foo)
+	foo.Spec.Replicas = int32Ptr(2)
+	expDeployment := newDeployment(foo)
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(foo, t))
+}
+
+func TestUpdateStatus(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(2))
+	d := newDeployment(foo)
+	d.Status.Replicas = 2
+	d.Status.AvailableReplicas = 2
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	expFoo := foo.DeepCopy()
+	expFoo.Status.AvailableReplicas = 2
+	expFoo.Status.Replicas = 2
+	expFoo.Status.Selector = "app=nginx,controller=test"
+	f.expectUpdateFooStatusAction(expFoo)
+	f.run(getKey(foo, t))
+}
+
+func TestNotControlledByUs(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	d := newDeployment(foo)
+	d.ObjectMeta.OwnerReferences = []metav1.OwnerReference{}
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.runExpectError(getKey(foo, t))
+}
+
+func TestDeploymentChangeEnqueuesFoo(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	f.fooLister = append(f.fooLister, foo)
+
+	c, _, _ := f.newController()
+	c.handleObject(cache.DeletedFinalStateUnknown{Key: "default/test-deployment", Obj: newDeployment(foo)})
+	// children of crd.jun.com Foos of the same name are not ours
+	c.handleObject(newJunDeployment(newJunFoo("test")))
+
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("workqueue has %d items, want 1", c.workqueue.Len())
+	}
+	if item, _ := c.workqueue.Get(); item != getKey(foo, t) {
+		t.Errorf("enqueued %v, want %s", item, getKey(foo, t))
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	crdv1 "github.com/2456868764/operator/crd/pkg/apis/crd.example.com/v1"
+	junv1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+)
+
+// crdCase is a CRD generated by hack/update-crds.sh and the types it is
+// generated from.
+type crdCase struct {
+	file    string
+	gv      schema.GroupVersion
+	obj     runtime.Object
+	list    runtime.Object
+	columns []string
+	scale   *apiextensionsv1.CustomResourceSubresourceScale
+}
+
+var fooSelectorPath = ".status.selector"
+
+var crdCases = []crdCase{
+	{
+		file:    "crd.example.com_foos.yaml",
+		gv:      crdv1.SchemeGroupVersion,
+		obj:     &crdv1.Foo{},
+		list:    &crdv1.FooList{},
+		columns: []string{"Deployment", "Replicas", "Available", "Age"},
+		scale: &apiextensionsv1.CustomResourceSubresourceScale{
+			SpecReplicasPath:   ".spec.replicas",
+			StatusReplicasPath: ".status.replicas",
+			LabelSelectorPath:  &fooSelectorPath,
+		},
+	},
+	{
+		file:    "crd.jun.com_foos.yaml",
+		gv:      junv1.GroupVersion,
+		obj:     &junv1.Foo{},
+		list:    &junv1.FooList{},
+		columns: []string{"Deployment", "Replicas", "Reachable", "URL", "Age"},
+		scale: &apiextensionsv1.CustomResourceSubresourceScale{
+			SpecReplicasPath:   ".spec.replicas",
+			StatusReplicasPath: ".status.replicas",
+			LabelSelectorPath:  &fooSelectorPath,
+		},
+	},
+}
+
+func loadCRD(t *testing.T, file string) *apiextensionsv1.CustomResourceDefinition {
+	data, err := os.ReadFile(filepath.Join("manifests", "config", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.UnmarshalStrict(data, crd); err != nil {
+		t.Fatalf("decoding %s: %v", file, err)
+	}
+	return crd
+}
+
+// jsonFields returns the json names of the fields of the struct type t.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func schemaProperties(props apiextensionsv1.JSONSchemaProps) []string {
+	var names []string
+	for name := range props.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCRDsMatchTypes(t *testing.T) {
+	for _, tc := range crdCases {
+		t.Run(tc.file, func(t *testing.T) {
+			crd := loadCRD(t, tc.file)
+			kind := reflect.TypeOf(tc.obj).Elem().Name()
+			listKind := reflect.TypeOf(tc.list).Elem().Name()
+			plural := strings.ToLower(kind) + "s"
+
+			if want := plural + "." + tc.gv.Group; crd.Name != want {
+				t.Errorf("got name %q, want %q", crd.Name, want)
+			}
+			if crd.Spec.Group != tc.gv.Group {
+				t.Errorf("got group %q, want %q", crd.Spec.Group, tc.gv.Group)
+			}
+			names := crd.Spec.Names
+			if names.Kind != kind || names.ListKind != listKind || names.Plural != plural {
+				t.Errorf("got names %+v, want kind %s, listKind %s and plural %s", names, kind, listKind, plural)
+			}
+			if len(crd.Spec.Versions) != 1 {
+				t.Fatalf("got %d versions, want 1", len(crd.Spec.Versions))
+			}
+			version := crd.Spec.Versions[0]
+			if version.Name != tc.gv.Version || !version.Served || !version.Storage {
+				t.Errorf("got version %s served %t storage %t, want served and stored %s",
+					version.Name, version.Served, version.Storage, tc.gv.Version)
+			}
+
+			root := version.Schema.OpenAPIV3Schema
+			objType := reflect.TypeOf(tc.obj).Elem()
+			for _, field := range []string{"Spec", "Status"} {
+				structField, _ := objType.FieldByName(field)
+				name := strings.Split(structField.Tag.Get("json"), ",")[0]
+				got := schemaProperties(root.Properties[name])
+				if want := jsonFields(structField.Type); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s has properties %v, want %v", name, got, want)
+				}
+			}
+
+			var columns []string
+			for _, column := range version.AdditionalPrinterColumns {
+				columns = append(columns, column.Name)
+			}
+			if !reflect.DeepEqual(columns, tc.columns) {
+				t.Errorf("got printer columns %v, want %v", columns, tc.columns)
+			}
+
+			if version.Subresources == nil || version.Subresources.Status == nil {
+				t.Error("missing status subresource")
+			}
+			var scale *apiextensionsv1.CustomResourceSubresourceScale
+			if version.Subresources != nil {
+				scale = version.Subresources.Scale
+			}
+			if !reflect.DeepEqual(scale, tc.scale) {
+				t.Errorf("got scale subresource %+v, want %+v", scale, tc.scale)
+			}
+		})
+	}
+}
+
+func TestCRDsAreStructural(t *testing.T) {
+	for _, tc := range crdCases {
+		t.Run(tc.file, func(t *testing.T) {
+			crd := loadCRD(t, tc.file)
+			for _, version := range crd.Spec.Versions {
+				internal := &apiextensions.JSONSchemaProps{}
+				if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(version.Schema.OpenAPIV3Schema, internal, nil); err != nil {
+					t.Fatal(err)
+				}
+				s, err := structuralschema.NewStructural(internal)
+				if err != nil {
+					t.Fatalf("version %s: %v", version.Name, err)
+				}
+				if errs := structuralschema.ValidateStructural(nil, s); len(errs) > 0 {
+					t.Errorf("version %s is not structural: %v", version.Name, errs.ToAggregate())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+#!/usr/bin/env bash
+
+# Copyright 2017 The Kubernetes Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Generates the CustomResourceDefinitions in manifests/config from the
+# kubebuilder markers of the types in pkg/apis.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+SCRIPT_ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+CONTROLLER_GEN_VERSION=${CONTROLLER_GEN_VERSION:-v0.16.5}
+CRD_OUTPUT_DIR=${CRD_OUTPUT_DIR:-"${SCRIPT_ROOT}/manifests/config"}
+
+CONTROLLER_GEN=${CONTROLLER_GEN:-"${SCRIPT_ROOT}/hack/bin/controller-gen"}
+if [[ ! -x "${CONTROLLER_GEN}" ]]; then
+  echo "installing controller-gen ${CONTROLLER_GEN_VERSION} into ${SCRIPT_ROOT}/hack/bin"
+  GOBIN="${SCRIPT_ROOT}/hack/bin" go install "sigs.k8s.io/controller-tools/cmd/controller-gen@${CONTROLLER_GEN_VERSION}"
+fi
+
+cd "${SCRIPT_ROOT}"
+"${CONTROLLER_GEN}" crd paths=./pkg/apis/... output:crd:dir="${CRD_OUTPUT_DIR}"
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	networkinginformers "k8s.io/client-go/informers/networking/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	junv1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+	"github.com/2456868764/operator/crd/pkg/junclient"
+)
+
+// junControllerAgentName is the event source of the crd.jun.com controller.
+const junControllerAgentName = "jun-foo-controller"
+
+// Reasons of the conditions of a crd.jun.com Foo.
+const (
+	ReasonReplicasAvailable   = "MinimumReplicasAvailable"
+	ReasonReplicasUnavailable = "ReplicasUnavailable"
+	ReasonIngressReady        = "IngressReady"
+	ReasonAddressPending      = "AddressPending"
+)
+
+// junServicePort is the port of the Service, it forwards to the nginx port.
+const junServicePort = 80
+
+// JunController reconciles each crd.jun.com Foo into a Deployment named
+// spec.deploymentName, and a Service and an Ingress for spec.serviceDomain
+// named after the Foo. The status reports the conditions and the URL.
+type JunController struct {
+	kubeclientset kubernetes.Interface
+	fooclient     junclient.FoosGetter
+
+	deploymentsLister appslisters.DeploymentLister
+	deploymentsSynced cache.InformerSynced
+	servicesLister    corelisters.ServiceLister
+	servicesSynced    cache.InformerSynced
+	ingressesLister   networkinglisters.IngressLister
+	ingressesSynced   cache.InformerSynced
+	foosIndexer       cache.Indexer
+	foosSynced        cache.InformerSynced
+
+	workqueue workqueue.RateLimitingInterface
+	recorder  record.EventRecorder
+}
+
+// NewJunController returns a new crd.jun.com Foo controller. fooInformer is
+// usually made with junclient.NewFooInformer.
+func NewJunController(
+	kubeclientset kubernetes.Interface,
+	fooclient junclient.FoosGetter,
+	deploymentInformer appsinformers.DeploymentInformer,
+	serviceInformer coreinformers.ServiceInformer,
+	ingressInformer networkinginformers.IngressInformer,
+	fooInformer cache.SharedIndexInformer) *JunController {
+
+	utilruntime.Must(junv1.AddToScheme(scheme.Scheme))
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: junControllerAgentName})
+
+	controller := &JunController{
+		kubeclientset:     kubeclientset,
+		fooclient:         fooclient,
+		deploymentsLister: deploymentInformer.Lister(),
+		deploymentsSynced: deploymentInformer.Informer().HasSynced,
+		servicesLister:    serviceInformer.Lister(),
+		servicesSynced:    serviceInformer.Informer().HasSynced,
+		ingressesLister:   ingressInformer.Lister(),
+		ingressesSynced:   ingressInformer.Informer().HasSynced,
+		foosIndexer:       fooInformer.GetIndexer(),
+		foosSynced:        fooInformer.HasSynced,
+		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "JunFoos"),
+		recorder:          recorder,
+	}
+
+	klog.Info("Setting up crd.jun.com event handlers")
+	fooInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueFoo,
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueFoo(new)
+		},
+	})
+	// Changes to the children requeue their Foo, e.g. to copy the ingress
+	// address to the status once it is assigned.
+	handlers := cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			if old.(metav1.Object).GetResourceVersion() == new.(metav1.Object).GetResourceVersion() {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	}
+	deploymentInformer.Informer().AddEventHandler(handlers)
+	serviceInformer.Informer().AddEventHandler(handlers)
+	ingressInformer.Informer().AddEventHandler(handlers)
+
+	return controller
+}
+
+// Run waits for the informer caches to sync and starts workers workers. It
+// blocks until ctx is canceled.
+func (c *JunController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	klog.Info("Starting crd.jun.com Foo controller")
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.servicesSynced, c.ingressesSynced, c.foosSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+	klog.Info("Shutting down crd.jun.com workers")
+	return nil
+}
+
+func (c *JunController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *JunController) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+	if err := c.syncHandler(ctx, key); err != nil {
+		c.workqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing %q: %w, requeuing", key, err))
+		return true
+	}
+	c.workqueue.Forget(obj)
+	klog.V(2).InfoS("Successfully synced", "key", key)
+	return true
+}
+
+// syncHandler makes the Deployment, Service and Ingress of the Foo with the
+// given key match its spec and then updates its status.
+func (c *JunController) syncHandler(ctx context.Context, key string) error {
+	obj, exists, err := c.foosIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// The children are garbage collected with the Foo.
+		klog.V(2).InfoS("Foo in work queue no longer exists", "key", key)
+		return nil
+	}
+	foo := obj.(*junv1.Foo)
+
+	if foo.Spec.DeploymentName == "" || foo.Spec.ServiceDomain == "" {
+		// Retrying would not help until the Foo is changed, which requeues it.
+		utilruntime.HandleError(fmt.Errorf("%s: deploymentName and serviceDomain must be specified", key))
+		return nil
+	}
+
+	deployment, err := c.syncDeployment(ctx, foo)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteStaleDeployments(ctx, foo); err != nil {
+		return err
+	}
+	if err := c.syncService(ctx, foo); err != nil {
+		return err
+	}
+	ingress, err := c.syncIngress(ctx, foo)
+	if err != nil {
+		return err
+	}
+	return c.updateFooStatus(ctx, foo, deployment, ingress)
+}
+
+func (c *JunController) syncDeployment(ctx context.Context, foo *junv1.Foo) (*appsv1.Deployment, error) {
+	deployment, err := c.deploymentsLister.Deployments(foo.Namespace).Get(foo.Spec.DeploymentName)
+	if errors.IsNotFound(err) {
+		return c.kubeclientset.AppsV1().Deployments(foo.Namespace).Create(ctx, newJunDeployment(foo), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkControlled(foo, deployment); err != nil {
+		return nil, err
+	}
+	replicas := junReplicas(foo)
+	if equality.Semantic.DeepEqual(deployment.Spec.Replicas, replicas) {
+		return deployment, nil
+	}
+	deploymentCopy := deployment.DeepCopy()
+	deploymentCopy.Spec.Replicas = replicas
+	return c.kubeclientset.AppsV1().Deployments(foo.Namespace).Update(ctx, deploymentCopy, metav1.UpdateOptions{})
+}
+
+// deleteStaleDeployments deletes the Deployments controlled by foo under
+// another name, they are left behind when spec.deploymentName changes.
+func (c *JunController) deleteStaleDeployments(ctx context.Context, foo *junv1.Foo) error {
+	deployments, err := c.deploymentsLister.Deployments(foo.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, deployment := range deployments {
+		if deployment.Name == foo.Spec.DeploymentName || !metav1.IsControlledBy(deployment, foo) {
+			continue
+		}
+		klog.InfoS("Deleting stale deployment", "foo", klog.KObj(foo), "deployment", klog.KObj(deployment))
+		err := c.kubeclientset.AppsV1().Deployments(foo.Namespace).Delete(ctx, deployment.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *JunController) syncService(ctx context.Context, foo *junv1.Foo) error {
+	desired := newJunService(foo)
+	service, err := c.servicesLister.Services(foo.Namespace).Get(desired.Name)
+	if errors.IsNotFound(err) {
+		_, err = c.kubeclientset.CoreV1().Services(foo.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.checkControlled(foo, service); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(service.Spec.Selector, desired.Spec.Selector) &&
+		equality.Semantic.DeepEqual(service.Spec.Ports, desired.Spec.Ports) {
+		return nil
+	}
+	// the cluster IP and the other defaulted fields are kept
+	serviceCopy := service.DeepCopy()
+	serviceCopy.Spec.Selector = desired.Spec.Selector
+	serviceCopy.Spec.Ports = desired.Spec.Ports
+	_, err = c.kubeclientset.CoreV1().Services(foo.Namespace).Update(ctx, serviceCopy, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *JunController) syncIngress(ctx context.Context, foo *junv1.Foo) (*networkingv1.Ingress, error) {
+	desired := newJunIngress(foo)
+	ingress, err := c.ingressesLister.Ingresses(foo.Namespace).Get(desired.Name)
+	if errors.IsNotFound(err) {
+		return c.kubeclientset.NetworkingV1().Ingresses(foo.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkControlled(foo, ingress); err != nil {
+		return nil, err
+	}
+	if equality.Semantic.DeepEqual(ingress.Spec.Rules, desired.Spec.Rules) {
+		return ingress, nil
+	}
+	ingressCopy := ingress.DeepCopy()
+	ingressCopy.Spec.Rules = desired.Spec.Rules
+	return c.kubeclientset.NetworkingV1().Ingresses(foo.Namespace).Update(ctx, ingressCopy, metav1.UpdateOptions{})
+}
+
+// checkControlled returns an error, and records it as an event, if object
+// is not controlled by foo.
+func (c *JunController) checkControlled(foo *junv1.Foo, object metav1.Object) error {
+	if metav1.IsControlledBy(object, foo) {
+		return nil
+	}
+	msg := fmt.Sprintf(MessageResourceExists, object.GetName())
+	c.recorder.Event(foo, corev1.EventTypeWarning, ErrResourceExists, msg)
+	return fmt.Errorf("%s", msg)
+}
+
+// updateFooStatus sets the conditions, URL, replicas and selector of foo
+// from its Deployment and Ingress, through the status subresource. Nothing is
+// written if the status does not change.
+func (c *JunController) updateFooStatus(ctx context.Context, foo *junv1.Foo, deployment *appsv1.Deployment, ingress *networkingv1.Ingress) error {
+	selector, err := deploymentSelector(deployment)
+	if err != nil {
+		return err
+	}
+	fooCopy := foo.DeepCopy()
+	status := &fooCopy.Status
+	status.Replicas = deployment.Status.Replicas
+	status.Selector = selector
+
+	replicas := int32(1)
+	if foo.Spec.Replicas != nil {
+		replicas = *foo.Spec.Replicas
+	}
+	available := metav1.Condition{
+		Type:               junv1.ConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonReplicasAvailable,
+		Message:            fmt.Sprintf("%d/%d replicas available", deployment.Status.AvailableReplicas, replicas),
+		ObservedGeneration: foo.Generation,
+	}
+	if deployment.Status.AvailableReplicas < replicas {
+		available.Status = metav1.ConditionFalse
+		available.Reason = ReasonReplicasUnavailable
+	}
+	meta.SetStatusCondition(&status.Conditions, available)
+
+	reachable := metav1.Condition{
+		Type:               junv1.ConditionReachable,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonAddressPending,
+		Message:            "Waiting for the ingress controller to assign an address",
+		ObservedGeneration: foo.Generation,
+	}
+	status.URL = ""
+	if address := ingressAddress(ingress); address != "" {
+		status.URL = "http://" + foo.Spec.ServiceDomain + "/"
+		reachable.Status = metav1.ConditionTrue
+		reachable.Reason = ReasonIngressReady
+		reachable.Message = fmt.Sprintf("Reachable at %s (address %s)", status.URL, address)
+	}
+	meta.SetStatusCondition(&status.Conditions, reachable)
+
+	if equality.Semantic.DeepEqual(foo.Status, fooCopy.Status) {
+		return nil
+	}
+	_, err = c.fooclient.Foos(foo.Namespace).UpdateStatus(ctx, fooCopy, metav1.UpdateOptions{})
+	return err
+}
+
+// ingressAddress returns the first load-balancer IP or hostname of ingress,
+// or "" while none is assigned.
+func ingressAddress(ingress *networkingv1.Ingress) string {
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			return lb.IP
+		}
+		if lb.Hostname != "" {
+			return lb.Hostname
+		}
+	}
+	return ""
+}
+
+func (c *JunController) enqueueFoo(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.workqueue.Add(key)
+}
+
+// handleObject enqueues the crd.jun.com Foo controlling obj, if any. obj may
+// be a tombstone of a deleted object.
+func (c *JunController) handleObject(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type %T", obj))
+		return
+	}
+	ownerRef := metav1.GetControllerOf(object)
+	if ownerRef == nil || ownerRef.APIVersion != junv1.GroupVersion.String() || ownerRef.Kind != "Foo" {
+		return
+	}
+	c.workqueue.Add(object.GetNamespace() + "/" + ownerRef.Name)
+}
+
+// junLabels differ from the labels of the crd.example.com controller, so that
+// the selectors of two Foos of the same name never select each other's pods.
+func junLabels(foo *junv1.Foo) map[string]string {
+	return map[string]string{
+		"app":     "jun-nginx",
+		"jun-foo": foo.Name,
+	}
+}
+
+// junReplicas returns the replicas of foo. A Foo stored before the default
+// was added to the CRD may have none, it gets the default of 1.
+func junReplicas(foo *junv1.Foo) *int32 {
+	if foo.Spec.Replicas == nil {
+		replicas := int32(1)
+		return &replicas
+	}
+	return foo.Spec.Replicas
+}
+
+func junOwnerReferences(foo *junv1.Foo) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(foo, junv1.GroupVersion.WithKind("Foo")),
+	}
+}
+
+// newJunDeployment returns the Deployment of foo running nginx.
+func newJunDeployment(foo *junv1.Foo) *appsv1.Deployment {
+	labels := junLabels(foo)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            foo.Spec.DeploymentName,
+			Namespace:       foo.Namespace,
+			OwnerReferences: junOwnerReferences(foo),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: junReplicas(foo),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "nginx",
+						Image: "nginx:latest",
+						Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 80}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// newJunService returns the Service of foo, selecting the pods of its
+// Deployment.
+func newJunService(foo *junv1.Foo) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            foo.Name,
+			Namespace:       foo.Namespace,
+			OwnerReferences: junOwnerReferences(foo),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: junLabels(foo),
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       junServicePort,
+				TargetPort: intstr.FromString("http"),
+			}},
+		},
+	}
+}
+
+// newJunIngress returns the Ingress routing spec.serviceDomain to the
+// Service of foo.
+func newJunIngress(foo *junv1.Foo) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            foo.Name,
+			Namespace:       foo.Namespace,
+			OwnerReferences: junOwnerReferences(foo),
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: foo.Spec.ServiceDomain,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: foo.Name,
+									Port: networkingv1.ServiceBackendPort{Number: junServicePort},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	junv1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+	"github.com/2456868764/operator/crd/pkg/junclient"
+)
+
+// fakeJunFoos records the status updates of crd.jun.com Foos, the other
+// methods are not used by the controller.
+type fakeJunFoos struct {
+	junclient.FooInterface
+	statusUpdates []*junv1.Foo
+}
+
+func (f *fakeJunFoos) Foos(namespace string) junclient.FooInterface {
+	return f
+}
+
+func (f *fakeJunFoos) UpdateStatus(ctx context.Context, foo *junv1.Foo, opts metav1.UpdateOptions) (*junv1.Foo, error) {
+	f.statusUpdates = append(f.statusUpdates, foo)
+	return foo, nil
+}
+
+type junFixture struct {
+	t *testing.T
+
+	kubeclient *k8sfake.Clientset
+	fooclient  *fakeJunFoos
+	recorder   *record.FakeRecorder
+	// Objects to put in the store.
+	foos        []*junv1.Foo
+	deployments []*appsv1.Deployment
+	services    []*corev1.Service
+	ingresses   []*networkingv1.Ingress
+	// Actions expected to happen on the kube client.
+	kubeactions []core.Action
+	kubeobjects []runtime.Object
+}
+
+func newJunFixture(t *testing.T) *junFixture {
+	return &junFixture{t: t, fooclient: &fakeJunFoos{}, recorder: record.NewFakeRecorder(10)}
+}
+
+func newJunFoo(name string) *junv1.Foo {
+	return &junv1.Foo{
+		TypeMeta: metav1.TypeMeta{APIVersion: junv1.GroupVersion.String(), Kind: "Foo"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  metav1.NamespaceDefault,
+			UID:        "foo-uid",
+			Generation: 1,
+		},
+		Spec: junv1.FooSpec{
+			DeploymentName: name + "-deployment",
+			Replicas:       int32Ptr(2),
+			ServiceDomain:  name + ".example.com",
+		},
+	}
+}
+
+func (f *junFixture) newController() *JunController {
+	f.kubeclient = k8sfake.NewSimpleClientset(f.kubeobjects...)
+	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, 0)
+	fooInformer := junclient.NewFooInformer(f.fooclient, metav1.NamespaceAll, 0)
+
+	c := NewJunController(f.kubeclient, f.fooclient,
+		k8sI.Apps().V1().Deployments(),
+		k8sI.Core().V1().Services(),
+		k8sI.Networking().V1().Ingresses(),
+		fooInformer)
+	c.recorder = f.recorder
+
+	for _, foo := range f.foos {
+		fooInformer.GetIndexer().Add(foo)
+	}
+	for _, d := range f.deployments {
+		k8sI.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
+	}
+	for _, s := range f.services {
+		k8sI.Core().V1().Services().Informer().GetIndexer().Add(s)
+	}
+	for _, ing := range f.ingresses {
+		k8sI.Networking().V1().Ingresses().Informer().GetIndexer().Add(ing)
+	}
+	return c
+}
+
+func (f *junFixture) run(key string, expectError bool) {
+	c := f.newController()
+	err := c.syncHandler(context.Background(), key)
+	if !expectError && err != nil {
+		f.t.Errorf("error syncing foo: %v", err)
+	} else if expectError && err == nil {
+		f.t.Error("expected error syncing foo, got nil")
+	}
+	checkActions(f.t, f.kubeactions, f.kubeclient.Actions())
+}
+
+func (f *junFixture) expectCreateAction(resource string, obj runtime.Object) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: resource}, metav1.NamespaceDefault, obj))
+}
+
+// withChildren adds the children of foo to the stores, with a ready
+// Deployment and an Ingress with an address.
+func (f *junFixture) withChildren(foo *junv1.Foo) {
+	d := newJunDeployment(foo)
+	d.Status.AvailableReplicas = 2
+	s := newJunService(foo)
+	ing := newJunIngress(foo)
+	ing.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "192.0.2.10"}}
+	f.deployments = append(f.deployments, d)
+	f.services = append(f.services, s)
+	f.ingresses = append(f.ingresses, ing)
+	f.kubeobjects = append(f.kubeobjects, d, s, ing)
+}
+
+func checkCondition(t *testing.T, foo *junv1.Foo, conditionType string, status metav1.ConditionStatus) {
+	condition := meta.FindStatusCondition(foo.Status.Conditions, conditionType)
+	if condition == nil {
+		t.Errorf("missing condition %s", conditionType)
+		return
+	}
+	if condition.Status != status || condition.ObservedGeneration != foo.Generation {
+		t.Errorf("got condition %+v, want status %s", condition, status)
+	}
+}
+
+func TestJunCreatesChildren(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	f.foos = append(f.foos, foo)
+
+	f.expectCreateAction("deployments", newJunDeployment(foo))
+	f.expectCreateAction("services", newJunService(foo))
+	f.expectCreateAction("ingresses", newJunIngress(foo))
+	f.run("default/test", false)
+
+	if len(f.fooclient.statusUpdates) != 1 {
+		t.Fatalf("got %d status updates, want 1", len(f.fooclient.statusUpdates))
+	}
+	updated := f.fooclient.statusUpdates[0]
+	checkCondition(t, updated, junv1.ConditionAvailable, metav1.ConditionFalse)
+	checkCondition(t, updated, junv1.ConditionReachable, metav1.ConditionFalse)
+	if updated.Status.URL != "" {
+		t.Errorf("got URL %q before the ingress has an address", updated.Status.URL)
+	}
+}
+
+func TestJunReachable(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	f.foos = append(f.foos, foo)
+	f.withChildren(foo)
+
+	f.run("default/test", false)
+
+	if len(f.fooclient.statusUpdates) != 1 {
+		t.Fatalf("got %d status updates, want 1", len(f.fooclient.statusUpdates))
+	}
+	updated := f.fooclient.statusUpdates[0]
+	checkCondition(t, updated, junv1.ConditionAvailable, metav1.ConditionTrue)
+	checkCondition(t, updated, junv1.ConditionReachable, metav1.ConditionTrue)
+	if want := "http://test.example.com/"; updated.Status.URL != want {
+		t.Errorf("got URL %q, want %q", updated.Status.URL, want)
+	}
+
+	// a second sync of the updated Foo changes nothing
+	f = newJunFixture(t)
+	f.foos = append(f.foos, updated)
+	f.withChildren(updated)
+	f.run("default/test", false)
+	if len(f.fooclient.statusUpdates) != 0 {
+		t.Errorf("got %d status updates of an unchanged status", len(f.fooclient.statusUpdates))
+	}
+}
+
+func TestJunUpdateChildren(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	f.withChildren(foo)
+	foo.Spec.Replicas = int32Ptr(3)
+	foo.Spec.ServiceDomain = "other.example.com"
+	f.foos = append(f.foos, foo)
+
+	d := f.deployments[0].DeepCopy()
+	d.Spec.Replicas = int32Ptr(3)
+	ing := f.ingresses[0].DeepCopy()
+	ing.Spec.Rules = newJunIngress(foo).Spec.Rules
+	f.kubeactions = append(f.kubeactions,
+		core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, foo.Namespace, d),
+		core.NewUpdateAction(schema.GroupVersionResource{Resource: "ingresses"}, foo.Namespace, ing))
+	f.run("default/test", false)
+}
+
+func TestJunDeleteStaleDeployment(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	f.withChildren(foo)
+	// a Deployment of another Foo is kept
+	other := newJunDeployment(newJunFoo("other"))
+	other.OwnerReferences[0].UID = "other-uid"
+	f.deployments = append(f.deployments, other)
+	f.kubeobjects = append(f.kubeobjects, other)
+	foo.Spec.DeploymentName = "renamed-deployment"
+	f.foos = append(f.foos, foo)
+
+	f.expectCreateAction("deployments", newJunDeployment(foo))
+	f.kubeactions = append(f.kubeactions,
+		core.NewDeleteAction(schema.GroupVersionResource{Resource: "deployments"}, foo.Namespace, "test-deployment"))
+	f.run("default/test", false)
+}
+
+func TestJunDefaultReplicas(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	foo.Spec.Replicas = int32Ptr(1)
+	f.withChildren(foo)
+	// the Deployment runs the default replicas already
+	foo.Spec.Replicas = nil
+	f.foos = append(f.foos, foo)
+
+	f.run("default/test", false)
+}
+
+func TestJunNotControlledByUs(t *testing.T) {
+	f := newJunFixture(t)
+	foo := newJunFoo("test")
+	f.foos = append(f.foos, foo)
+	f.withChildren(foo)
+	f.services[0].OwnerReferences = nil
+
+	f.run("default/test", true)
+
+	select {
+	case event := <-f.recorder.Events:
+		if want := "Warning ErrResourceExists Resource \"test\" already exists and is not managed by Foo"; event != want {
+			t.Errorf("got event %q, want %q", event, want)
+		}
+	default:
+		t.Error("expected an event")
+	}
+}
+
+func TestJunHandleObject(t *testing.T) {
+	f := newJunFixture(t)
+	c := f.newController()
+	foo := newJunFoo("test")
+
+	c.handleObject(cache.DeletedFinalStateUnknown{Key: "default/test", Obj: newJunIngress(foo)})
+	// children of crd.example.com Foos are not ours
+	c.handleObject(newDeployment(newFoo("other", int32Ptr(1))))
+
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("workqueue has %d items, want 1", c.workqueue.Len())
+	}
+	if item, _ := c.workqueue.Get(); item != "default/test" {
+		t.Errorf("enqueued %v, want default/test", item)
+	}
+}
@@ -2,82 +2,108 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	v12 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
 	clientset "github.com/2456868764/operator/crd/pkg/generated/clientset/versioned"
 	"github.com/2456868764/operator/crd/pkg/generated/informers/externalversions"
+	"github.com/2456868764/operator/crd/pkg/junclient"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"log"
+	"k8s.io/klog/v2"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	//clientSet()
-	restClient()
+	klog.InitFlags(nil)
+	workers := flag.Int("workers", 2, "Number of Foos synced in parallel.")
+	jun := flag.Bool("jun", false, "Also reconcile crd.jun.com Foos into a Deployment, Service and Ingress. Needs the crd.jun.com CRD.")
+	junFoo := flag.String("get-jun-foo", "", "Print the crd.jun.com Foo namespace/name and exit instead of running the controller.")
+	flag.Parse()
 
-}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-func restClient() {
 	config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
 	if err != nil {
-		log.Fatalln(err)
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			klog.Fatalf("Error building config: %s", err)
+		}
 	}
 
-	config.APIPath = "apis"
-	config.GroupVersion = &v12.GroupVersion
-	config.NegotiatedSerializer = v12.Codec
-
-	restClient, err := rest.RESTClientFor(config)
-	if err != nil {
-		log.Fatalln(err)
+	if *junFoo != "" {
+		if err := getJunFoo(ctx, config, *junFoo); err != nil {
+			klog.Fatalf("Error getting %s: %s", *junFoo, err)
+		}
+		return
 	}
 
-	foo := v12.Foo{}
-	restClient.Get().Namespace("default").Resource("foos").Name("example-jun-foo").Do(context.TODO()).Into(&foo)
-	fmt.Printf("%+v", foo)
-}
-
-func clientSet() {
-	config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
+	kubeClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Fatalln(err)
+		klog.Fatalf("Error building kubernetes clientset: %s", err)
 	}
-
-	clientSet, err := clientset.NewForConfig(config)
+	fooClient, err := clientset.NewForConfig(config)
 	if err != nil {
-		log.Fatalln(err)
+		klog.Fatalf("Error building foo clientset: %s", err)
 	}
 
-	list, err := clientSet.CrdV1().Foos("default").List(context.TODO(), v1.ListOptions{})
-	if err != nil {
-		log.Fatalln(err)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	fooInformerFactory := externalversions.NewSharedInformerFactory(fooClient, 0)
+	controller := NewController(kubeClient, fooClient,
+		kubeInformerFactory.Apps().V1().Deployments(),
+		fooInformerFactory.Crd().V1().Foos())
+
+	var junController *JunController
+	var junInformer cache.SharedIndexInformer
+	if *jun {
+		junClient, err := junclient.NewForConfig(config)
+		if err != nil {
+			klog.Fatalf("Error building crd.jun.com client: %s", err)
+		}
+		junInformer = junclient.NewFooInformer(junClient, v1.NamespaceAll, 0)
+		junController = NewJunController(kubeClient, junClient,
+			kubeInformerFactory.Apps().V1().Deployments(),
+			kubeInformerFactory.Core().V1().Services(),
+			kubeInformerFactory.Networking().V1().Ingresses(),
+			junInformer)
 	}
 
-	for _, foo := range list.Items {
-		println(foo.Name)
-	}
-
-	factory := externalversions.NewSharedInformerFactory(clientSet, 0)
-	factory.Crd().V1().Foos().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			log.Printf("add object:%v", obj)
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			log.Printf("update object:%v", newObj)
-		},
-
-		DeleteFunc: func(obj interface{}) {
-			log.Printf("delete object:%v", obj)
-		},
-	})
+	kubeInformerFactory.Start(ctx.Done())
+	fooInformerFactory.Start(ctx.Done())
 
-	stopCh := make(chan struct{})
-
-	factory.Start(stopCh)
-	factory.WaitForCacheSync(stopCh)
-
-	<-stopCh
+	if junController != nil {
+		go junInformer.Run(ctx.Done())
+		go func() {
+			if err := junController.Run(ctx, *workers); err != nil {
+				klog.Fatalf("Error running crd.jun.com controller: %s", err)
+			}
+		}()
+	}
+	if err := controller.Run(ctx, *workers); err != nil {
+		klog.Fatalf("Error running controller: %s", err)
+	}
+}
 
+// getJunFoo prints the crd.jun.com Foo namespace/name.
+func getJunFoo(ctx context.Context, config *rest.Config, ref string) error {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = "default", ref
+	}
+	client, err := junclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	foo, err := client.Foos(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%+v\n", foo)
+	return nil
 }
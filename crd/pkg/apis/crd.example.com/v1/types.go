@@ -22,28 +22,54 @@ import (
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Deployment",type=string,JSONPath=`.spec.deploymentName`
+// +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Foo is a specification for a Foo resource
 type Foo struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   FooSpec   `json:"spec"`
+	Spec FooSpec `json:"spec"`
+	// +optional
 	Status FooStatus `json:"status"`
 }
 
 // FooSpec is the spec for a Foo resource
 type FooSpec struct {
+	// DeploymentName is the name of the Deployment created for the Foo.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
 	DeploymentName string `json:"deploymentName"`
-	Replicas       *int32 `json:"replicas"`
+	// Replicas is the number of pods of the Deployment.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	Replicas *int32 `json:"replicas"`
 }
 
 // FooStatus is the status for a Foo resource
 type FooStatus struct {
+	// AvailableReplicas is the number of available pods of the Deployment.
+	// +optional
 	AvailableReplicas int32 `json:"availableReplicas"`
+	// Replicas is the number of pods of the Deployment, for the scale
+	// subresource.
+	// +optional
+	Replicas int32 `json:"replicas"`
+	// Selector is the label selector of the pods of the Deployment in
+	// string form, for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
 
 // FooList is a list of Foo resources
 type FooList struct {
@@ -2,14 +2,43 @@
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
 var (
+	// GroupVersion is the group version of the Foo API.
+	GroupVersion = schema.GroupVersion{Group: "crd.jun.com", Version: "v1"}
+
+	// SchemeBuilder registers the Foo types and the metav1 types the API
+	// server sends along, like Status, WatchEvent and the list options.
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme adds the Foo API to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+
+	// Schema holds the Foo API, it is ready to use.
 	Schema = runtime.NewScheme()
-	GroupVersion = schema.GroupVersion{"cr.jun.com", "v1"}
+	// Codec encodes and decodes the types of Schema.
 	Codec = serializer.NewCodecFactory(Schema)
+	// ParameterCodec converts option structs like metav1.ListOptions to
+	// query parameters.
+	ParameterCodec = runtime.NewParameterCodec(Schema)
+)
+
+func init() {
+	utilruntime.Must(AddToScheme(Schema))
+}
+
+// Resource takes an unqualified resource and returns a Group qualified GroupResource
+func Resource(resource string) schema.GroupResource {
+	return GroupVersion.WithResource(resource).GroupResource()
+}
 
-)
\ No newline at end of file
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(GroupVersion, &Foo{}, &FooList{})
+	metav1.AddToGroupVersion(scheme, GroupVersion)
+	return nil
+}
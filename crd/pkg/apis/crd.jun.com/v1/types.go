@@ -4,24 +4,56 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
-
 // FooSpec defines the desired state of Foo
 type FooSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS -- desired state of cluster
+	// DeploymentName is the name of the Deployment running the Foo.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
 	DeploymentName string `json:"deploymentName"`
+	// Replicas is the number of pods of the Deployment.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
 	Replicas *int32 `json:"replicas"`
+	// ServiceDomain is the host the Foo is reachable at through its Ingress.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +kubebuilder:validation:MaxLength=253
 	ServiceDomain string `json:"serviceDomain"`
 }
 
 // FooStatus defines the observed state of Foo.
 // It should always be reconstructable from the state of the cluster and/or outside world.
 type FooStatus struct {
-	// INSERT ADDITIONAL STATUS FIELDS -- observed state of cluster
+	// Conditions are Available, once the Deployment has all its replicas
+	// available, and Reachable, once the Ingress has an address.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// URL is where the Foo is reachable, it is set once it is Reachable.
+	URL string `json:"url,omitempty"`
+	// Replicas is the number of pods of the Deployment, for the scale
+	// subresource.
+	// +optional
+	Replicas int32 `json:"replicas"`
+	// Selector is the label selector of the pods of the Deployment in
+	// string form, for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
 }
 
-// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// Condition types of a Foo.
+const (
+	ConditionAvailable = "Available"
+	ConditionReachable = "Reachable"
+)
+
+// +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Deployment",type=string,JSONPath=`.spec.deploymentName`
+// +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Reachable",type=string,JSONPath=`.status.conditions[?(@.type=="Reachable")].status`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Foo is the Schema for the FooList API
 // +k8s:openapi-gen=true
@@ -33,7 +65,7 @@ type Foo struct {
 	Status FooStatus `json:"status,omitempty"`
 }
 
-// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
 
 // FooList contains a list of Foo
 type FooList struct {
@@ -41,8 +73,3 @@ type FooList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []Foo `json:"items"`
 }
-
-func init() {
-	Schema.AddKnownTypes(GroupVersion, &Foo{}, &FooList{})
-}
-
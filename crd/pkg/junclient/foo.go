@@ -0,0 +1,159 @@
+// Package junclient is a hand-written typed client for the crd.jun.com API,
+// which has no generated clientset.
+package junclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+)
+
+// FooInterface has methods to work with crd.jun.com Foo resources.
+type FooInterface interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.Foo, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1.FooList, error)
+	Create(ctx context.Context, foo *v1.Foo, opts metav1.CreateOptions) (*v1.Foo, error)
+	Update(ctx context.Context, foo *v1.Foo, opts metav1.UpdateOptions) (*v1.Foo, error)
+	UpdateStatus(ctx context.Context, foo *v1.Foo, opts metav1.UpdateOptions) (*v1.Foo, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// Client talks to the crd.jun.com/v1 API.
+type Client struct {
+	restClient rest.Interface
+}
+
+// NewForConfig returns a Client for c. c is copied and set up for the
+// crd.jun.com/v1 API, other settings like the host and credentials are kept.
+func NewForConfig(c *rest.Config) (*Client, error) {
+	config := *c
+	config.APIPath = "/apis"
+	config.GroupVersion = &v1.GroupVersion
+	config.NegotiatedSerializer = v1.Codec.WithoutConversion()
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	restClient, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return New(restClient), nil
+}
+
+// New returns a Client using restClient, which has to be set up for the
+// crd.jun.com/v1 API.
+func New(restClient rest.Interface) *Client {
+	return &Client{restClient: restClient}
+}
+
+// RESTClient returns the underlying REST client.
+func (c *Client) RESTClient() rest.Interface {
+	return c.restClient
+}
+
+// Foos returns the Foos of namespace.
+func (c *Client) Foos(namespace string) FooInterface {
+	return &foos{client: c.restClient, ns: namespace}
+}
+
+type foos struct {
+	client rest.Interface
+	ns     string
+}
+
+func (c *foos) Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.Foo, error) {
+	result := &v1.Foo{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("foos").
+		Name(name).
+		VersionedParams(&opts, v1.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+func (c *foos) List(ctx context.Context, opts metav1.ListOptions) (*v1.FooList, error) {
+	result := &v1.FooList{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource("foos").
+		VersionedParams(&opts, v1.ParameterCodec).
+		Timeout(timeout(opts)).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+func (c *foos) Create(ctx context.Context, foo *v1.Foo, opts metav1.CreateOptions) (*v1.Foo, error) {
+	result := &v1.Foo{}
+	err := c.client.Post().
+		Namespace(c.ns).
+		Resource("foos").
+		VersionedParams(&opts, v1.ParameterCodec).
+		Body(foo).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+func (c *foos) Update(ctx context.Context, foo *v1.Foo, opts metav1.UpdateOptions) (*v1.Foo, error) {
+	result := &v1.Foo{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("foos").
+		Name(foo.Name).
+		VersionedParams(&opts, v1.ParameterCodec).
+		Body(foo).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus writes the status through the status subresource, changes to
+// the rest of foo are ignored by the API server.
+func (c *foos) UpdateStatus(ctx context.Context, foo *v1.Foo, opts metav1.UpdateOptions) (*v1.Foo, error) {
+	result := &v1.Foo{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource("foos").
+		Name(foo.Name).
+		SubResource("status").
+		VersionedParams(&opts, v1.ParameterCodec).
+		Body(foo).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+func (c *foos) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("foos").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+func (c *foos) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("foos").
+		VersionedParams(&opts, v1.ParameterCodec).
+		Timeout(timeout(opts)).
+		Watch(ctx)
+}
+
+func timeout(opts metav1.ListOptions) time.Duration {
+	if opts.TimeoutSeconds == nil {
+		return 0
+	}
+	return time.Duration(*opts.TimeoutSeconds) * time.Second
+}
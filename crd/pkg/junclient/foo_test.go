@@ -0,0 +1,284 @@
+package junclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+)
+
+const foosPath = "/apis/crd.jun.com/v1/namespaces/default/foos"
+
+// fakeServer is a minimal API server for Foos in the default namespace.
+type fakeServer struct {
+	t *testing.T
+
+	mu   sync.Mutex
+	foos map[string]v1.Foo
+	// requests records "METHOD path?query" of every request.
+	requests []string
+}
+
+func newFakeServer(t *testing.T, foos ...v1.Foo) (*fakeServer, *Client) {
+	s := &fakeServer{t: t, foos: map[string]v1.Foo{}}
+	for _, foo := range foos {
+		s.foos[foo.Name] = foo
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	client, err := NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	s.requests = append(s.requests, request)
+
+	if !strings.HasPrefix(r.URL.Path, foosPath) {
+		s.writeStatus(w, errors.NewNotFound(v1.Resource("foos"), r.URL.Path))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, foosPath), "/"), "/")
+	name := parts[0]
+
+	switch {
+	case r.Method == http.MethodGet && name == "" && r.URL.Query().Get("watch") == "true":
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		for _, foo := range s.foos {
+			foo := foo
+			s.encode(encoder, metav1.WatchEvent{Type: string(watch.Added), Object: rawFoo(s.t, &foo)})
+		}
+	case r.Method == http.MethodGet && name == "":
+		list := v1.FooList{TypeMeta: metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "FooList"}}
+		for _, foo := range s.foos {
+			list.Items = append(list.Items, foo)
+		}
+		s.write(w, http.StatusOK, list)
+	case r.Method == http.MethodGet:
+		foo, ok := s.foos[name]
+		if !ok {
+			s.writeStatus(w, errors.NewNotFound(v1.Resource("foos"), name))
+			return
+		}
+		s.write(w, http.StatusOK, foo)
+	case r.Method == http.MethodPost:
+		foo := s.read(r)
+		if _, ok := s.foos[foo.Name]; ok {
+			s.writeStatus(w, errors.NewAlreadyExists(v1.Resource("foos"), foo.Name))
+			return
+		}
+		foo.ResourceVersion = "1"
+		s.foos[foo.Name] = foo
+		s.write(w, http.StatusCreated, foo)
+	case r.Method == http.MethodPut:
+		foo := s.read(r)
+		stored, ok := s.foos[name]
+		if !ok {
+			s.writeStatus(w, errors.NewNotFound(v1.Resource("foos"), name))
+			return
+		}
+		if len(parts) > 1 && parts[1] == "status" {
+			stored.Status = foo.Status
+		} else {
+			stored.Spec = foo.Spec
+		}
+		s.foos[name] = stored
+		s.write(w, http.StatusOK, stored)
+	case r.Method == http.MethodDelete:
+		if _, ok := s.foos[name]; !ok {
+			s.writeStatus(w, errors.NewNotFound(v1.Resource("foos"), name))
+			return
+		}
+		delete(s.foos, name)
+		s.write(w, http.StatusOK, metav1.Status{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}, Status: metav1.StatusSuccess})
+	default:
+		s.writeStatus(w, errors.NewMethodNotSupported(v1.Resource("foos"), r.Method))
+	}
+}
+
+func (s *fakeServer) read(r *http.Request) v1.Foo {
+	var foo v1.Foo
+	if err := json.NewDecoder(r.Body).Decode(&foo); err != nil {
+		s.t.Errorf("decoding request body: %v", err)
+	}
+	if foo.APIVersion != v1.GroupVersion.String() || foo.Kind != "Foo" {
+		s.t.Errorf("request body has apiVersion %q and kind %q", foo.APIVersion, foo.Kind)
+	}
+	return foo
+}
+
+func (s *fakeServer) write(w http.ResponseWriter, code int, obj interface{}) {
+	if foo, ok := obj.(v1.Foo); ok {
+		foo.APIVersion, foo.Kind = v1.GroupVersion.String(), "Foo"
+		obj = foo
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	s.encode(json.NewEncoder(w), obj)
+}
+
+func (s *fakeServer) writeStatus(w http.ResponseWriter, err *errors.StatusError) {
+	status := err.Status()
+	status.APIVersion, status.Kind = "v1", "Status"
+	s.write(w, int(status.Code), status)
+}
+
+func (s *fakeServer) encode(encoder *json.Encoder, obj interface{}) {
+	if err := encoder.Encode(obj); err != nil {
+		s.t.Errorf("encoding response: %v", err)
+	}
+}
+
+func rawFoo(t *testing.T, foo *v1.Foo) runtime.RawExtension {
+	foo.APIVersion, foo.Kind = v1.GroupVersion.String(), "Foo"
+	data, err := json.Marshal(foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: data}
+}
+
+func newFoo(name string) v1.Foo {
+	replicas := int32(1)
+	return v1.Foo{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		Spec:       v1.FooSpec{DeploymentName: name, Replicas: &replicas, ServiceDomain: name + ".example.com"},
+	}
+}
+
+func TestGet(t *testing.T) {
+	_, client := newFakeServer(t, newFoo("test"))
+
+	foo, err := client.Foos("default").Get(context.Background(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.Name != "test" || foo.Spec.ServiceDomain != "test.example.com" {
+		t.Errorf("got %+v", foo)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	_, client := newFakeServer(t)
+
+	_, err := client.Foos("default").Get(context.Background(), "missing", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("got error %v, want not found", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	server, client := newFakeServer(t, newFoo("a"), newFoo("b"))
+
+	list, err := client.Foos("default").List(context.Background(), metav1.ListOptions{LabelSelector: "app=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 2 {
+		t.Errorf("got %d foos, want 2", len(list.Items))
+	}
+	if want := "GET " + foosPath + "?labelSelector=app%3Dweb"; server.requests[0] != want {
+		t.Errorf("got request %q, want %q", server.requests[0], want)
+	}
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	server, client := newFakeServer(t)
+	ctx := context.Background()
+	foo := newFoo("test")
+
+	created, err := client.Foos("default").Create(ctx, &foo, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ResourceVersion != "1" {
+		t.Errorf("got resource version %q, want 1", created.ResourceVersion)
+	}
+	if _, err := client.Foos("default").Create(ctx, &foo, metav1.CreateOptions{}); !errors.IsAlreadyExists(err) {
+		t.Errorf("got error %v, want already exists", err)
+	}
+
+	created.Spec.ServiceDomain = "other.example.com"
+	updated, err := client.Foos("default").Update(ctx, created, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Spec.ServiceDomain != "other.example.com" {
+		t.Errorf("got service domain %q", updated.Spec.ServiceDomain)
+	}
+
+	if err := client.Foos("default").Delete(ctx, "test", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Foos("default").Delete(ctx, "test", metav1.DeleteOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got error %v, want not found", err)
+	}
+
+	want := []string{
+		"POST " + foosPath,
+		"POST " + foosPath,
+		"PUT " + foosPath + "/test",
+		"DELETE " + foosPath + "/test",
+		"DELETE " + foosPath + "/test",
+	}
+	if strings.Join(server.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got requests\n%s\nwant\n%s", strings.Join(server.requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	server, client := newFakeServer(t, newFoo("test"))
+
+	foo := newFoo("test")
+	foo.Spec.ServiceDomain = "ignored.example.com"
+	if _, err := client.Foos("default").UpdateStatus(context.Background(), &foo, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "PUT " + foosPath + "/test/status"; server.requests[0] != want {
+		t.Errorf("got request %q, want %q", server.requests[0], want)
+	}
+	if got := server.foos["test"].Spec.ServiceDomain; got != "test.example.com" {
+		t.Errorf("status update changed the spec to %q", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	_, client := newFakeServer(t, newFoo("test"))
+
+	w, err := client.Foos("default").Watch(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	select {
+	case event := <-w.ResultChan():
+		foo, ok := event.Object.(*v1.Foo)
+		if event.Type != watch.Added || !ok || foo.Name != "test" {
+			t.Errorf("got event %s %#v", event.Type, event.Object)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event")
+	}
+}
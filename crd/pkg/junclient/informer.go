@@ -0,0 +1,35 @@
+package junclient
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/2456868764/operator/crd/pkg/apis/crd.jun.com/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// FoosGetter returns the Foos of a namespace, it is implemented by Client.
+type FoosGetter interface {
+	Foos(namespace string) FooInterface
+}
+
+// NewFooInformer returns an informer for the Foos of namespace, which may be
+// metav1.NamespaceAll. It is indexed by namespace.
+func NewFooInformer(client FoosGetter, namespace string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.Foos(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.Foos(namespace).Watch(context.TODO(), options)
+			},
+		},
+		&v1.Foo{},
+		resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ingressv1beta1 "github.com/kubebuilder-demo/api/v1beta1"
+	"github.com/kubebuilder-demo/controllers/utils"
+)
+
+const (
+	// ErrResourceExists is used as part of the Event 'reason' when an App
+	// fails to sync due to a child of the same name already existing.
+	ErrResourceExists = "ErrResourceExists"
+	// MessageResourceExists is the message used for Events when a child
+	// fails to sync due to it already existing.
+	MessageResourceExists = "Resource %q already exists and is not managed by App"
+)
+
+// AppReconciler reconciles a App object
+type AppReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=ingress.baiding.tech,resources=apps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=ingress.baiding.tech,resources=apps/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ingress.baiding.tech,resources=apps/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile renders the Deployment, Service and Ingress of an App from the
+// templates in controllers/utils and converges the cluster towards them.
+// The Service and Ingress are deleted again once they are disabled, and the
+// status of the App reports the available replicas of its Deployment.
+func (r *AppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	app := &ingressv1beta1.App{}
+	if err := r.Get(ctx, req.NamespacedName, app); err != nil {
+		// The children of a deleted App are garbage collected.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	deployment, err := r.reconcileDeployment(ctx, app)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile deployment")
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileService(ctx, app); err != nil {
+		logger.Error(err, "Failed to reconcile service")
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileIngress(ctx, app); err != nil {
+		logger.Error(err, "Failed to reconcile ingress")
+		return ctrl.Result{}, err
+	}
+
+	if app.Status.AvailableReplicas != deployment.Status.AvailableReplicas {
+		app.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+		if err := r.Status().Update(ctx, app); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *AppReconciler) reconcileDeployment(ctx context.Context, app *ingressv1beta1.App) (*appv1.Deployment, error) {
+	desired, err := utils.NewDeployment(app)
+	if err != nil {
+		return nil, err
+	}
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		if err := r.checkControlled(app, deployment); err != nil {
+			return err
+		}
+		if deployment.Spec.Selector == nil {
+			// a new Deployment takes the whole rendered spec
+			deployment.Labels = desired.Labels
+			deployment.Spec = desired.Spec
+		} else {
+			// the selector is immutable and the rest of an existing spec
+			// carries server defaults, only the fields of the App are set
+			deployment.Spec.Replicas = desired.Spec.Replicas
+			setImages(&deployment.Spec.Template.Spec, desired.Spec.Template.Spec.Containers)
+		}
+		return controllerutil.SetControllerReference(app, deployment, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logDone(ctx, op, "Deployment", deployment)
+	return deployment, nil
+}
+
+// setImages sets the image of each container of spec to the image of the
+// container of the same name in containers, adding missing containers.
+func setImages(spec *corev1.PodSpec, containers []corev1.Container) {
+	for _, want := range containers {
+		found := false
+		for i := range spec.Containers {
+			if spec.Containers[i].Name == want.Name {
+				spec.Containers[i].Image = want.Image
+				found = true
+			}
+		}
+		if !found {
+			spec.Containers = append(spec.Containers, want)
+		}
+	}
+}
+
+func (r *AppReconciler) reconcileService(ctx context.Context, app *ingressv1beta1.App) error {
+	desired, err := utils.NewService(app)
+	if err != nil {
+		return err
+	}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	if !app.Spec.EnableService {
+		return r.deleteIfOwned(ctx, app, "Service", service)
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		if err := r.checkControlled(app, service); err != nil {
+			return err
+		}
+		// the cluster IP and the other defaulted fields are kept
+		service.Spec.Selector = desired.Spec.Selector
+		service.Spec.Ports = desired.Spec.Ports
+		return controllerutil.SetControllerReference(app, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	logDone(ctx, op, "Service", service)
+	return nil
+}
+
+func (r *AppReconciler) reconcileIngress(ctx context.Context, app *ingressv1beta1.App) error {
+	desired, err := utils.NewIngress(app)
+	if err != nil {
+		return err
+	}
+	ingress := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	// The Ingress routes to the Service, it is useless without it.
+	if !app.Spec.EnableIngress || !app.Spec.EnableService {
+		return r.deleteIfOwned(ctx, app, "Ingress", ingress)
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, ingress, func() error {
+		if err := r.checkControlled(app, ingress); err != nil {
+			return err
+		}
+		ingress.Spec.IngressClassName = desired.Spec.IngressClassName
+		ingress.Spec.Rules = desired.Spec.Rules
+		return controllerutil.SetControllerReference(app, ingress, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	logDone(ctx, op, "Ingress", ingress)
+	return nil
+}
+
+// checkControlled returns an error, and records it as an event on app, if obj
+// exists already and is not controlled by app. Objects of the same name
+// created by someone else are never taken over.
+func (r *AppReconciler) checkControlled(app *ingressv1beta1.App, obj client.Object) error {
+	if obj.GetUID() == "" || metav1.IsControlledBy(obj, app) {
+		return nil
+	}
+	msg := fmt.Sprintf(MessageResourceExists, obj.GetName())
+	r.Recorder.Event(app, corev1.EventTypeWarning, ErrResourceExists, msg)
+	return fmt.Errorf("%s", msg)
+}
+
+// deleteIfOwned deletes obj, identified by its name and namespace, if it
+// exists and is controlled by app. Objects of the same name that app does not
+// control are left alone.
+func (r *AppReconciler) deleteIfOwned(ctx context.Context, app *ingressv1beta1.App, kind string, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, app) {
+		return nil
+	}
+	if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("Deleted disabled object", "kind", kind, "name", obj.GetName())
+	return nil
+}
+
+// logDone logs the changes CreateOrUpdate made to obj.
+func logDone(ctx context.Context, op controllerutil.OperationResult, kind string, obj client.Object) {
+	if op == controllerutil.OperationResultNone {
+		return
+	}
+	log.FromContext(ctx).Info("Reconciled object", "kind", kind, "name", obj.GetName(), "operation", op)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AppReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ingressv1beta1.App{}).
+		Owns(&appv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&netv1.Ingress{}).
+		Complete(r)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ingressv1beta1 "github.com/kubebuilder-demo/api/v1beta1"
+)
+
+var appKey = types.NamespacedName{Namespace: "default", Name: "demo"}
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := ingressv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func newApp(enableService, enableIngress bool) *ingressv1beta1.App {
+	return &ingressv1beta1.App{
+		ObjectMeta: metav1.ObjectMeta{Name: appKey.Name, Namespace: appKey.Namespace, UID: "app-uid"},
+		Spec: ingressv1beta1.AppSpec{
+			Image:         "nginx:1.25",
+			Replicas:      2,
+			EnableService: enableService,
+			EnableIngress: enableIngress,
+		},
+	}
+}
+
+func newReconciler(t *testing.T, objs ...client.Object) *AppReconciler {
+	scheme := newScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return &AppReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+}
+
+func reconcile(t *testing.T, r *AppReconciler) {
+	t.Helper()
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: appKey})
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result != (ctrl.Result{}) {
+		t.Errorf("got result %+v, want no requeue", result)
+	}
+}
+
+// getApp returns the stored App, after the reconciler changed it.
+func getApp(t *testing.T, r *AppReconciler) *ingressv1beta1.App {
+	t.Helper()
+	app := &ingressv1beta1.App{}
+	if err := r.Get(context.Background(), appKey, app); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// checkExists gets obj by the App key and checks it is controlled by app.
+func checkExists(t *testing.T, r *AppReconciler, app *ingressv1beta1.App, obj client.Object) {
+	t.Helper()
+	if err := r.Get(context.Background(), appKey, obj); err != nil {
+		t.Fatalf("getting %T: %v", obj, err)
+	}
+	if !metav1.IsControlledBy(obj, app) {
+		t.Errorf("%T has owner references %+v, want controlled by the app", obj, obj.GetOwnerReferences())
+	}
+}
+
+func checkNotExists(t *testing.T, r *AppReconciler, obj client.Object) {
+	t.Helper()
+	if err := r.Get(context.Background(), appKey, obj); !errors.IsNotFound(err) {
+		t.Errorf("getting %T: got error %v, want not found", obj, err)
+	}
+}
+
+func TestReconcileCreatesChildren(t *testing.T) {
+	tests := []struct {
+		name          string
+		enableService bool
+		enableIngress bool
+		wantService   bool
+		wantIngress   bool
+	}{
+		{name: "deployment only"},
+		{name: "service", enableService: true, wantService: true},
+		{name: "service and ingress", enableService: true, enableIngress: true, wantService: true, wantIngress: true},
+		{name: "ingress without service", enableIngress: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(tt.enableService, tt.enableIngress)
+			r := newReconciler(t, app)
+			reconcile(t, r)
+			app = getApp(t, r)
+
+			deployment := &appv1.Deployment{}
+			checkExists(t, r, app, deployment)
+			if *deployment.Spec.Replicas != 2 || deployment.Spec.Template.Spec.Containers[0].Image != "nginx:1.25" {
+				t.Errorf("got deployment spec %+v", deployment.Spec)
+			}
+
+			if tt.wantService {
+				checkExists(t, r, app, &corev1.Service{})
+			} else {
+				checkNotExists(t, r, &corev1.Service{})
+			}
+			if tt.wantIngress {
+				ingress := &netv1.Ingress{}
+				checkExists(t, r, app, ingress)
+				if host := ingress.Spec.Rules[0].Host; host != "demo.baiding.tech" {
+					t.Errorf("got ingress host %q", host)
+				}
+			} else {
+				checkNotExists(t, r, &netv1.Ingress{})
+			}
+		})
+	}
+}
+
+func TestReconcileUpdatesDeployment(t *testing.T) {
+	app := newApp(false, false)
+	r := newReconciler(t, app)
+	reconcile(t, r)
+
+	app = getApp(t, r)
+	app.Spec.Image = "nginx:1.26"
+	app.Spec.Replicas = 3
+	if err := r.Update(context.Background(), app); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r)
+
+	deployment := &appv1.Deployment{}
+	checkExists(t, r, app, deployment)
+	if *deployment.Spec.Replicas != 3 {
+		t.Errorf("got %d replicas, want 3", *deployment.Spec.Replicas)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "nginx:1.26" {
+		t.Errorf("got image %q, want nginx:1.26", image)
+	}
+}
+
+func TestReconcileDeletesDisabledChildren(t *testing.T) {
+	app := newApp(true, true)
+	r := newReconciler(t, app)
+	reconcile(t, r)
+
+	app = getApp(t, r)
+	app.Spec.EnableService = false
+	app.Spec.EnableIngress = false
+	if err := r.Update(context.Background(), app); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r)
+
+	checkExists(t, r, app, &appv1.Deployment{})
+	checkNotExists(t, r, &corev1.Service{})
+	checkNotExists(t, r, &netv1.Ingress{})
+}
+
+func TestReconcileLeavesForeignObjects(t *testing.T) {
+	// a Service of the same name that the App does not control
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: appKey.Name, Namespace: appKey.Namespace}}
+	r := newReconciler(t, newApp(false, false), service)
+	reconcile(t, r)
+
+	if err := r.Get(context.Background(), appKey, &corev1.Service{}); err != nil {
+		t.Errorf("foreign service was deleted: %v", err)
+	}
+}
+
+func TestReconcileRefusesForeignObjects(t *testing.T) {
+	// an existing Service of the same name that the App does not control
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: appKey.Name, Namespace: appKey.Namespace, UID: "foreign-uid"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "other"}},
+	}
+	r := newReconciler(t, newApp(true, false), service)
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: appKey}); err == nil {
+		t.Fatal("reconcile: got no error for the foreign service")
+	}
+
+	got := &corev1.Service{}
+	if err := r.Get(context.Background(), appKey, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.OwnerReferences) > 0 || got.Spec.Selector["app"] != "other" {
+		t.Errorf("foreign service was taken over: %+v", got)
+	}
+	select {
+	case event := <-r.Recorder.(*record.FakeRecorder).Events:
+		if !strings.HasPrefix(event, corev1.EventTypeWarning+" "+ErrResourceExists) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected an event for the foreign service")
+	}
+}
+
+func TestReconcileUpdatesStatus(t *testing.T) {
+	app := newApp(false, false)
+	r := newReconciler(t, app)
+	reconcile(t, r)
+	if got := getApp(t, r).Status.AvailableReplicas; got != 0 {
+		t.Errorf("got %d available replicas before the deployment is ready", got)
+	}
+
+	deployment := &appv1.Deployment{}
+	if err := r.Get(context.Background(), appKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status.AvailableReplicas = 2
+	if err := r.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r)
+
+	if got := getApp(t, r).Status.AvailableReplicas; got != 2 {
+		t.Errorf("got %d available replicas, want 2", got)
+	}
+}
+
+func TestReconcileMissingApp(t *testing.T) {
+	r := newReconciler(t)
+	reconcile(t, r)
+	checkNotExists(t, r, &appv1.Deployment{})
+}
@@ -2,50 +2,90 @@ package utils
 
 import (
 	"bytes"
+	"embed"
+	"fmt"
+	"sync"
+	"text/template"
+
 	"github.com/kubebuilder-demo/api/v1beta1"
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
-	"text/template"
 )
 
-func parseTemplate(templateName string, app *v1beta1.App) []byte {
-	tmpl, err := template.ParseFiles("controllers/template/" + templateName + ".yml")
+// The templates are compiled into the binary, so rendering does not depend
+// on the working directory.
+//
+//go:embed template/*.yml
+var templateFS embed.FS
+
+var (
+	templatesOnce sync.Once
+	templates     *template.Template
+	templatesErr  error
+)
+
+// loadTemplates parses the embedded templates once and returns them.
+func loadTemplates() (*template.Template, error) {
+	templatesOnce.Do(func() {
+		templates, templatesErr = template.ParseFS(templateFS, "template/*.yml")
+	})
+	return templates, templatesErr
+}
+
+func parseTemplate(templateName string, app *v1beta1.App) ([]byte, error) {
+	tmpls, err := loadTemplates()
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+	tmpl := tmpls.Lookup(templateName + ".yml")
+	if tmpl == nil {
+		return nil, fmt.Errorf("template %q not found", templateName)
 	}
 	b := new(bytes.Buffer)
-	err = tmpl.Execute(b, app)
+	if err := tmpl.Execute(b, app); err != nil {
+		return nil, fmt.Errorf("executing template %q: %w", templateName, err)
+	}
+	return b.Bytes(), nil
+}
+
+// render executes the template templateName for app and decodes the result
+// into obj.
+func render(templateName string, app *v1beta1.App, obj interface{}) error {
+	data, err := parseTemplate(templateName, app)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return b.Bytes()
+	if err := yaml.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("decoding template %q: %w", templateName, err)
+	}
+	return nil
 }
 
-func NewDeployment(app *v1beta1.App) *appv1.Deployment {
+// NewDeployment renders the Deployment of app.
+func NewDeployment(app *v1beta1.App) (*appv1.Deployment, error) {
 	d := &appv1.Deployment{}
-	err := yaml.Unmarshal(parseTemplate("deployment", app), d)
-	if err != nil {
-		panic(err)
+	if err := render("deployment", app, d); err != nil {
+		return nil, err
 	}
-	return d
+	return d, nil
 }
 
-func NewIngress(app *v1beta1.App) *netv1.Ingress {
+// NewIngress renders the Ingress of app.
+func NewIngress(app *v1beta1.App) (*netv1.Ingress, error) {
 	i := &netv1.Ingress{}
-	err := yaml.Unmarshal(parseTemplate("ingress", app), i)
-	if err != nil {
-		panic(err)
+	if err := render("ingress", app, i); err != nil {
+		return nil, err
 	}
-	return i
+	return i, nil
 }
 
-func NewService(app *v1beta1.App) *corev1.Service {
+// NewService renders the Service of app.
+func NewService(app *v1beta1.App) (*corev1.Service, error) {
 	s := &corev1.Service{}
-	err := yaml.Unmarshal(parseTemplate("service", app), s)
-	if err != nil {
-		panic(err)
+	if err := render("service", app, s); err != nil {
+		return nil, err
 	}
-	return s
+	return s, nil
 }
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubebuilder-demo/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func newApp(name, namespace, image string, replicas int32) *v1beta1.App {
+	return &v1beta1.App{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       v1beta1.AppSpec{Image: image, Replicas: replicas},
+	}
+}
+
+// checkGolden compares the YAML of obj with testdata/<name>.golden.yaml,
+// rewriting the file instead with -update.
+func checkGolden(t *testing.T, name string, obj interface{}) {
+	t.Helper()
+	got, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", name+".golden.yaml")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match, got:\n%s", golden, got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		app  *v1beta1.App
+	}{
+		{name: "default", app: newApp("demo", "default", "nginx:latest", 1)},
+		{name: "scaled", app: newApp("shop", "prod", "registry.example.com/team/shop:v2", 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDeployment(tt.app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name+"_deployment", d)
+
+			s, err := NewService(tt.app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name+"_service", s)
+
+			i, err := NewIngress(tt.app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name+"_ingress", i)
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	if _, err := NewDeployment(nil); err == nil {
+		t.Error("rendering a nil app: got no error")
+	}
+	if _, err := parseTemplate("missing", newApp("demo", "default", "nginx", 1)); err == nil {
+		t.Error("rendering a missing template: got no error")
+	}
+}